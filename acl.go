@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+// setACLsRequest is the body of PUT /channel/{channelID}/acls. ACLs maps API resources such as
+// qscc/GetBlockByNumber to policy paths like /Channel/Application/Readers, an empty path removes the ACL.
+type setACLsRequest struct {
+	identityRequest
+	ACLs        map[string]string `json:"acls"`
+	Description string            `json:"description,omitempty"`
+	TTL         string            `json:"ttl,omitempty"`
+	Orderer     string            `json:"orderer,omitempty"`
+
+	channelID string
+	ttl       time.Duration
+}
+
+func (r *setACLsRequest) validate() error {
+	r.setDefaults()
+	op := configOperation{Op: opSetACLs, ACLs: r.ACLs}
+	if err := op.validate(); err != nil {
+		return err
+	}
+	ttl, err := parseProposalTTL(r.TTL)
+	if err != nil {
+		return err
+	}
+	r.ttl = ttl
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// setPolicyRequest is the body of PUT /channel/{channelID}/policies. It adds or replaces the named
+// policy of the group at Path, e.g. /Channel/Application and Endorsement.
+type setPolicyRequest struct {
+	identityRequest
+	Path string `json:"path"`
+	applicationPolicyRequest
+	Description string `json:"description,omitempty"`
+	TTL         string `json:"ttl,omitempty"`
+	Orderer     string `json:"orderer,omitempty"`
+
+	channelID string
+	ttl       time.Duration
+}
+
+func (r *setPolicyRequest) validate() error {
+	r.setDefaults()
+	op := configOperation{Op: opSetPolicy, Path: r.Path, Policy: &r.applicationPolicyRequest}
+	if err := op.validate(); err != nil {
+		return err
+	}
+	ttl, err := parseProposalTTL(r.TTL)
+	if err != nil {
+		return err
+	}
+	r.ttl = ttl
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// channelACLsHandler serves GET and PUT /channel/{channelID}/acls.
+func channelACLsHandler(w http.ResponseWriter, r *http.Request, channelID string) {
+	switch r.Method {
+	case http.MethodGet:
+		identity, orderer := configQuery(r)
+		result, err := doGetChannelACLs(sdkProfileOf(r), identity, channelID, orderer)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{Result: result})
+	default:
+		dryRun, err := isDryRun(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		req := setACLsRequest{channelID: channelID}
+		if err := decodeRequestMethod(r, http.MethodPut, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		op := configOperation{Op: opSetACLs, ACLs: req.ACLs}
+		p, err := doProposeConfigOperation(sdkProfileOf(r), req.identityRequest, req.channelID, req.Orderer, req.Description, req.ttl, op, dryRun)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+	}
+}
+
+// channelPolicies serves GET and PUT /channel/{channelID}/policies.
+func channelPolicies(w http.ResponseWriter, r *http.Request, channelID string) {
+	switch r.Method {
+	case http.MethodGet:
+		identity, orderer := configQuery(r)
+		result, err := doGetChannelPolicies(sdkProfileOf(r), identity, channelID, orderer)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{Result: result})
+	default:
+		dryRun, err := isDryRun(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		req := setPolicyRequest{channelID: channelID}
+		if err := decodeRequestMethod(r, http.MethodPut, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		op := configOperation{Op: opSetPolicy, Path: req.Path, Policy: &req.applicationPolicyRequest}
+		p, err := doProposeConfigOperation(sdkProfileOf(r), req.identityRequest, req.channelID, req.Orderer, req.Description, req.ttl, op, dryRun)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+	}
+}
+
+// configQuery reads the identity and orderer of a GET request on the channel config.
+func configQuery(r *http.Request) (identityRequest, string) {
+	q := r.URL.Query()
+	identity := identityRequest{Org: q.Get("org"), User: q.Get("user")}
+	identity.setDefaults()
+	orderer := q.Get("orderer")
+	if orderer == "" {
+		orderer = ordererEndpoint
+	}
+	return identity, orderer
+}
+
+func doGetChannelACLs(profile sdkProfile, identity identityRequest, channelID, orderer string) (result map[string]string, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+	if err != nil {
+		return nil, err
+	}
+	if config.ChannelGroup.Groups[applicationGroupKey] == nil {
+		return nil, badRequest("%s has no application group", channelID)
+	}
+	return channelACLs(config)
+}
+
+func doGetChannelPolicies(profile sdkProfile, identity identityRequest, channelID, orderer string) (result []policySummary, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+	if err != nil {
+		return nil, err
+	}
+	result = []policySummary{}
+	collectPolicies("/Channel", config.ChannelGroup, &result)
+	return result, nil
+}
+
+func collectPolicies(path string, group *common.ConfigGroup, policies *[]policySummary) {
+	for _, name := range sortedKeys(group.Policies) {
+		cp := group.Policies[name]
+		ps := policySummary{Path: path + "/" + name, ModPolicy: cp.ModPolicy}
+		ps.Type, ps.Rule = policyRule(cp.Policy)
+		*policies = append(*policies, ps)
+	}
+	for _, name := range sortedKeys(group.Groups) {
+		collectPolicies(path+"/"+name, group.Groups[name], policies)
+	}
+}
+
+// doProposeConfigOperation applies one operation to the latest config and proposes the update, or
+// only previews it on a dry run.
+func doProposeConfigOperation(profile sdkProfile, identity identityRequest, channelID, orderer, description string, ttl time.Duration, op configOperation, dryRun bool) (p *configProposal, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := applyConfigOperations(channelID, config, []configOperation{op})
+	if err != nil {
+		return nil, err
+	}
+	if description == "" {
+		description = fmt.Sprintf("%s on %s", op.Op, channelID)
+	}
+	return newConfigProposal(sdk, identity, channelID, description, config, tx, ttl, orderer, true, dryRun)
+}
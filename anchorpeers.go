@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// orgAnchorPeers is the anchor peers of one application org of a channel.
+type orgAnchorPeers struct {
+	Name        string              `json:"name"`
+	MSPID       string              `json:"mspID"`
+	AnchorPeers []anchorPeerRequest `json:"anchorPeers"`
+}
+
+// setAnchorPeersRequest is the body of PUT /channel/{channelID}/anchorpeers. The anchor peers of the
+// org are replaced by the given list, an empty list removes them.
+type setAnchorPeersRequest struct {
+	identityRequest
+	// Name is the config group name of the org, the application org of the request identity by default.
+	Name        string              `json:"name,omitempty"`
+	AnchorPeers []anchorPeerRequest `json:"anchorPeers"`
+	Description string              `json:"description,omitempty"`
+	TTL         string              `json:"ttl,omitempty"`
+	Orderer     string              `json:"orderer,omitempty"`
+
+	channelID string
+	ttl       time.Duration
+	dryRun    bool
+}
+
+func (r *setAnchorPeersRequest) validate() error {
+	r.setDefaults()
+	if r.AnchorPeers == nil {
+		return fmt.Errorf("anchorPeers is required")
+	}
+	seen := make(map[anchorPeerRequest]bool)
+	for _, ap := range r.AnchorPeers {
+		if err := ap.validate(); err != nil {
+			return err
+		}
+		if seen[ap] {
+			return fmt.Errorf("duplicate anchor peer %s:%d", ap.Host, ap.Port)
+		}
+		seen[ap] = true
+	}
+	ttl, err := parseProposalTTL(r.TTL)
+	if err != nil {
+		return err
+	}
+	r.ttl = ttl
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// channelAnchorPeers serves GET and PUT /channel/{channelID}/anchorpeers.
+func channelAnchorPeers(w http.ResponseWriter, r *http.Request, channelID string) {
+	switch r.Method {
+	case http.MethodGet:
+		identity, orderer := configQuery(r)
+		result, err := doGetAnchorPeers(sdkProfileOf(r), identity, channelID, orderer)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{Result: result})
+	default:
+		dryRun, err := isDryRun(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		req := setAnchorPeersRequest{channelID: channelID, dryRun: dryRun}
+		if err := decodeRequestMethod(r, http.MethodPut, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		p, err := doSetAnchorPeers(sdkProfileOf(r), &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+	}
+}
+
+func doGetAnchorPeers(profile sdkProfile, identity identityRequest, channelID, orderer string) (result []orgAnchorPeers, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+	if err != nil {
+		return nil, err
+	}
+	app := config.ChannelGroup.Groups[applicationGroupKey]
+	if app == nil {
+		return nil, badRequest("%s has no application orgs", channelID)
+	}
+	result = []orgAnchorPeers{}
+	for name, group := range app.Groups {
+		org := orgAnchorPeers{Name: name, MSPID: orgMSPID(group), AnchorPeers: []anchorPeerRequest{}}
+		if v, ok := group.Values[anchorPeersKey]; ok {
+			aps := &pb.AnchorPeers{}
+			if err := proto.Unmarshal(v.Value, aps); err != nil {
+				return nil, fmt.Errorf("invalid anchor peers of %s: %v", name, err)
+			}
+			for _, ap := range aps.AnchorPeers {
+				org.AnchorPeers = append(org.AnchorPeers, anchorPeerRequest{Host: ap.Host, Port: int(ap.Port)})
+			}
+		}
+		result = append(result, org)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func doSetAnchorPeers(profile sdkProfile, req *setAnchorPeersRequest) (p *configProposal, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, req.identityRequest, req.channelID, req.Orderer)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		id, err := sdk.signingIdentity(req.Org, req.User)
+		if err != nil {
+			return nil, err
+		}
+		mspID := id.Identifier().MSPID
+		for name, group := range config.ChannelGroup.Groups[applicationGroupKey].GetGroups() {
+			if orgMSPID(group) == mspID {
+				req.Name = name
+			}
+		}
+		if req.Name == "" {
+			return nil, badRequest("msp %s is not an application org of %s", mspID, req.channelID)
+		}
+	}
+	op := configOperation{Op: opSetAnchorPeers, Org: req.Name, AnchorPeers: req.AnchorPeers}
+	tx, err := applyConfigOperations(req.channelID, config, []configOperation{op})
+	if err != nil {
+		return nil, err
+	}
+	if req.Description == "" {
+		req.Description = fmt.Sprintf("%s %s", op.Op, req.Name)
+	}
+	return newConfigProposal(sdk, req.identityRequest, req.channelID, req.Description, config, tx, req.ttl, req.Orderer, true, req.dryRun)
+}
+
+// orgMSPID returns the MSP ID of an org config group.
+func orgMSPID(group *common.ConfigGroup) string {
+	msps := make(map[string]*mspproto.FabricMSPConfig)
+	collectMSPs(group, msps)
+	for id := range msps {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+)
+
+// apiResponse is the JSON body written by every handler.
+type apiResponse struct {
+	TxID        string      `json:"txID,omitempty"`
+	BlockNumber *uint64     `json:"blockNumber,omitempty"`
+	Result      interface{} `json:"result,omitempty"`
+	Error       *apiError   `json:"error,omitempty"`
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	// Group and Code are filled from the fabric-sdk-go status attached to the error, if any.
+	Group string `json:"group,omitempty"`
+	Code  int32  `json:"code,omitempty"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return &apiError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, a...)}
+}
+
+// validator is implemented by every request body. validate also fills in defaults.
+type validator interface {
+	validate() error
+}
+
+func decodeRequest(r *http.Request, req validator) error {
+	return decodeRequestMethod(r, http.MethodPost, req)
+}
+
+// decodeRequestMethod is decodeRequest for handlers taking the body with another method, e.g. PUT.
+func decodeRequestMethod(r *http.Request, method string, req validator) error {
+	if r.Method != method {
+		return &apiError{Status: http.StatusMethodNotAllowed, Message: fmt.Sprintf("method %s not allowed", r.Method)}
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		return badRequest("invalid request body: %v", err)
+	}
+	if err := req.validate(); err != nil {
+		return badRequest("invalid request: %v", err)
+	}
+	return nil
+}
+
+func writeResponse(w http.ResponseWriter, resp apiResponse) {
+	code := http.StatusOK
+	if resp.Error != nil {
+		code = resp.Error.Status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	log.Println(err.Error())
+	var ae *apiError
+	if !errors.As(err, &ae) {
+		ae = &apiError{Status: http.StatusInternalServerError, Message: err.Error()}
+		if s, ok := status.FromError(err); ok {
+			ae.Group = s.Group.String()
+			ae.Code = s.Code
+		}
+	}
+	writeResponse(w, apiResponse{Error: ae})
+}
+
+// parseTimeout parses an optional positive duration such as "30s" given in field.
+func parseTimeout(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", field, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive", field)
+	}
+	return d, nil
+}
+
+// identityRequest selects the SDK organization and user a request is executed as.
+type identityRequest struct {
+	Org  string `json:"org,omitempty"`
+	User string `json:"user,omitempty"`
+}
+
+func (r *identityRequest) setDefaults() {
+	if r.Org == "" {
+		r.Org = sdkOrg
+	}
+	if r.User == "" {
+		r.User = sdkAdmin
+	}
+}
+
+type anchorPeerRequest struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+func (r anchorPeerRequest) validate() error {
+	if r.Host == "" {
+		return fmt.Errorf("anchor peer host is required")
+	}
+	if r.Port <= 0 || r.Port > 65535 {
+		return fmt.Errorf("invalid anchor peer port %d", r.Port)
+	}
+	return nil
+}
+
+// orgRequest describes an organization taking part in a network or channel.
+type orgRequest struct {
+	Name        string              `json:"name"`
+	MSPID       string              `json:"mspID"`
+	MSPDir      string              `json:"mspDir"`
+	AnchorPeers []anchorPeerRequest `json:"anchorPeers,omitempty"`
+	// Policies overrides the default org policies by name, e.g. Admins or Endorsement.
+	Policies map[string]orgPolicyRequest `json:"policies,omitempty"`
+}
+
+type orgPolicyRequest struct {
+	Type string `json:"type"` // Signature or ImplicitMeta
+	Rule string `json:"rule"`
+}
+
+func (p orgPolicyRequest) validate() error {
+	switch p.Type {
+	case "Signature":
+		if _, err := policydsl.FromString(p.Rule); err != nil {
+			return fmt.Errorf("invalid Signature rule %q: %v", p.Rule, err)
+		}
+	case "ImplicitMeta":
+		fields := strings.Fields(p.Rule)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid ImplicitMeta rule %q, expected e.g. MAJORITY Admins", p.Rule)
+		}
+		if _, ok := implicitMetaRules[strings.ToUpper(fields[0])]; !ok {
+			return fmt.Errorf("invalid ImplicitMeta rule %q, expected e.g. MAJORITY Admins", p.Rule)
+		}
+	default:
+		return fmt.Errorf("policy type must be Signature or ImplicitMeta")
+	}
+	return nil
+}
+
+func (r *orgRequest) validate() error {
+	if r.MSPID == "" {
+		return fmt.Errorf("org mspID is required")
+	}
+	if r.Name == "" {
+		r.Name = r.MSPID
+	}
+	if r.MSPDir == "" {
+		return fmt.Errorf("org %s: mspDir is required", r.Name)
+	}
+	for _, ap := range r.AnchorPeers {
+		if err := ap.validate(); err != nil {
+			return fmt.Errorf("org %s: %v", r.Name, err)
+		}
+	}
+	for name, p := range r.Policies {
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("org %s: policy %s: %v", r.Name, name, err)
+		}
+	}
+	return nil
+}
+
+func validateOrgs(field string, orgs []orgRequest) error {
+	if len(orgs) == 0 {
+		return fmt.Errorf("%s is required", field)
+	}
+	seen := make(map[string]bool)
+	for i := range orgs {
+		if err := orgs[i].validate(); err != nil {
+			return err
+		}
+		if seen[orgs[i].Name] {
+			return fmt.Errorf("%s: duplicate org %s", field, orgs[i].Name)
+		}
+		seen[orgs[i].Name] = true
+	}
+	return nil
+}
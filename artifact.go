@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+)
+
+const artifactStoreDir = "./artifacts"
+
+// artifactResult describes a generated artifact. The digest is SHA-256 or SM3, following the hash
+// algorithm of the sdk profile that built it.
+type artifactResult struct {
+	ID              string `json:"id,omitempty"`
+	Digest          string `json:"digest"`
+	DigestAlgorithm string `json:"digestAlgorithm"`
+	Size            int    `json:"size"`
+	// Path is the directory crypto material generated with output dir was written to
+	Path string `json:"path,omitempty"`
+
+	name string
+	data []byte
+}
+
+func newArtifact(cc context.Client, name string, data []byte) (*artifactResult, error) {
+	ho := cc.SigningManager().GetHashOpts()
+	digest, err := cc.CryptoSuite().Hash(data, ho)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash artifact: %v", err)
+	}
+	return artifactOf(name, data, ho.Algorithm(), digest), nil
+}
+
+func artifactOf(name string, data []byte, algorithm string, digest []byte) *artifactResult {
+	return &artifactResult{
+		Digest:          hex.EncodeToString(digest),
+		DigestAlgorithm: algorithm,
+		Size:            len(data),
+		name:            name,
+		data:            data,
+	}
+}
+
+// artifactStore keeps artifacts in a directory, named by their digest.
+type artifactStore struct {
+	dir string
+}
+
+var artifacts = &artifactStore{dir: artifactStoreDir}
+
+var artifactIDPattern = regexp.MustCompile(`^[a-z0-9]+-[0-9a-f]+$`)
+
+// put stores the artifact and sets its ID, e.g. sha256-2c26b46b...
+func (s *artifactStore) put(a *artifactResult) error {
+	id := strings.ToLower(a.DigestAlgorithm) + "-" + a.Digest
+	path := filepath.Join(s.dir, id)
+	if _, err := os.Stat(path); err == nil {
+		a.ID = id
+		return nil
+	}
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+	// write and rename, a concurrent reader never sees half an artifact
+	f, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(a.data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	a.ID = id
+	log.Printf("stored artifact %s (%d bytes)\n", id, len(a.data))
+	return nil
+}
+
+func (s *artifactStore) get(id string) ([]byte, error) {
+	if !artifactIDPattern.MatchString(id) {
+		return nil, badRequest("invalid artifact id %q", id)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, id))
+	if os.IsNotExist(err) {
+		return nil, &apiError{Status: http.StatusNotFound, Message: fmt.Sprintf("artifact %s is not found", id)}
+	}
+	return data, err
+}
+
+// saveArtifact keeps a generated artifact in the artifact store if asked to.
+func saveArtifact(a *artifactResult, store bool) error {
+	if !store {
+		return nil
+	}
+	return artifacts.put(a)
+}
+
+// writeArtifact sends the artifact itself, or its description if the client asks for JSON.
+func writeArtifact(w http.ResponseWriter, r *http.Request, a *artifactResult) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeResponse(w, apiResponse{Result: a})
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(a.data)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.name}))
+	w.Header().Set("X-Artifact-Digest", a.Digest)
+	w.Header().Set("X-Artifact-Digest-Algorithm", a.DigestAlgorithm)
+	if a.ID != "" {
+		w.Header().Set("X-Artifact-Id", a.ID)
+	}
+	if _, err := w.Write(a.data); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func getArtifact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, &apiError{Status: http.StatusMethodNotAllowed, Message: fmt.Sprintf("method %s not allowed", r.Method)})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, badRequest("invalid request: id is required"))
+		return
+	}
+	data, err := artifacts.get(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Artifact-Id", id)
+	if _, err := w.Write(data); err != nil {
+		log.Println(err.Error())
+	}
+}
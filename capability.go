@@ -0,0 +1,519 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+const (
+	channelGroupPath     = "/Channel"
+	ordererGroupPath     = "/Channel/Orderer"
+	applicationGroupPath = "/Channel/Application"
+)
+
+// capabilityLevels are the capabilities fabric knows for each group, lowest first.
+var capabilityLevels = map[string][]string{
+	channelGroupPath:     {"V1_1", "V1_3", "V1_4_2", "V1_4_3", "V2_0", "V3_0"},
+	ordererGroupPath:     {"V1_1", "V1_4_2", "V2_0"},
+	applicationGroupPath: {"V1_1", "V1_2", "V1_3", "V1_4_2", "V2_0", "V2_5"},
+}
+
+func checkCapability(path, capability string) error {
+	levels, ok := capabilityLevels[path]
+	if !ok {
+		return fmt.Errorf("capabilities are set on %s, %s or %s, not %s", channelGroupPath, ordererGroupPath, applicationGroupPath, path)
+	}
+	for _, l := range levels {
+		if l == capability {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s capability %q, expected one of %s", path, capability, strings.Join(levels, ", "))
+}
+
+// capabilityVersion turns V2_5 into [2 5 0], the fabric release that introduced it.
+func capabilityVersion(capability string) []int {
+	v := []int{0, 0, 0}
+	for i, s := range strings.SplitN(strings.TrimPrefix(capability, "V"), "_", 3) {
+		v[i], _ = strconv.Atoi(s)
+	}
+	return v
+}
+
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareCapabilities(a, b string) int {
+	return compareVersions(capabilityVersion(a), capabilityVersion(b))
+}
+
+func groupCapabilities(group *common.ConfigGroup) ([]string, error) {
+	caps := []string{}
+	v, ok := group.GetValues()[capabilitiesKey]
+	if !ok {
+		return caps, nil
+	}
+	c := &common.Capabilities{}
+	if err := proto.Unmarshal(v.Value, c); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", capabilitiesKey, err)
+	}
+	for name := range c.Capabilities {
+		caps = append(caps, name)
+	}
+	sort.Slice(caps, func(i, j int) bool { return compareCapabilities(caps[i], caps[j]) < 0 })
+	return caps, nil
+}
+
+// channelCapabilities is the capabilities of the groups of one channel, the system channel has no application.
+type channelCapabilities struct {
+	ChannelID   string   `json:"channelID"`
+	Channel     []string `json:"channel"`
+	Orderer     []string `json:"orderer"`
+	Application []string `json:"application,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// nodeVersion is the binary version a peer or orderer reports on its operations endpoint.
+type nodeVersion struct {
+	Endpoint string `json:"endpoint"`
+	Version  string `json:"version,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type capabilityReport struct {
+	Channels []channelCapabilities `json:"channels"`
+	Nodes    []nodeVersion         `json:"nodes,omitempty"`
+}
+
+// capabilityChannels selects the channels of a capability report or upgrade, the system channel first.
+type capabilityChannels struct {
+	Channels          []string `json:"channels,omitempty"`
+	SystemChannel     string   `json:"systemChannel,omitempty"`
+	SkipSystemChannel bool     `json:"skipSystemChannel,omitempty"`
+	// OperationsEndpoints are the operations services of the peers and orderers, e.g. https://peer0.org1.example.com:9443,
+	// their /version is checked before an upgrade. OperationsCACert is a PEM file to verify them with.
+	OperationsEndpoints []string `json:"operationsEndpoints,omitempty"`
+	OperationsCACert    string   `json:"operationsCACert,omitempty"`
+}
+
+func (c *capabilityChannels) validate() error {
+	if c.SkipSystemChannel && len(c.Channels) == 0 {
+		return fmt.Errorf("channels is required when the system channel is skipped")
+	}
+	if c.SystemChannel == "" {
+		c.SystemChannel = systemChannelName
+	}
+	for _, ch := range c.Channels {
+		if ch == "" || ch == c.SystemChannel {
+			return fmt.Errorf("invalid channel %q", ch)
+		}
+	}
+	for _, ep := range c.OperationsEndpoints {
+		if !strings.HasPrefix(ep, "http://") && !strings.HasPrefix(ep, "https://") {
+			return fmt.Errorf("invalid operations endpoint %q", ep)
+		}
+	}
+	return nil
+}
+
+func (c *capabilityChannels) list() []string {
+	var channels []string
+	if !c.SkipSystemChannel {
+		channels = append(channels, c.SystemChannel)
+	}
+	return append(channels, c.Channels...)
+}
+
+// upgradeCapabilitiesRequest is the body of POST /network/capabilities. Empty levels are left alone.
+type upgradeCapabilitiesRequest struct {
+	identityRequest
+	capabilityChannels
+	ChannelCapability     string `json:"channelCapability,omitempty"`
+	OrdererCapability     string `json:"ordererCapability,omitempty"`
+	ApplicationCapability string `json:"applicationCapability,omitempty"`
+	// Signers sign every update, the channel group needs both orderer and application admins.
+	Signers []identityRequest `json:"signers,omitempty"`
+	Orderer string            `json:"orderer,omitempty"`
+	// Timeout bounds waiting for one update to be committed, e.g. "2m".
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+	dryRun  bool
+}
+
+func (r *upgradeCapabilitiesRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelCapability == "" && r.OrdererCapability == "" && r.ApplicationCapability == "" {
+		return fmt.Errorf("channelCapability, ordererCapability or applicationCapability is required")
+	}
+	for path, c := range r.targets() {
+		if err := checkCapability(path, c); err != nil {
+			return err
+		}
+	}
+	if err := r.capabilityChannels.validate(); err != nil {
+		return err
+	}
+	for i := range r.Signers {
+		r.Signers[i].setDefaults()
+	}
+	if len(r.Signers) == 0 {
+		r.Signers = []identityRequest{r.identityRequest}
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	timeout, err := parseTimeout("timeout", r.Timeout)
+	if err != nil {
+		return err
+	}
+	r.timeout = timeout
+	if r.timeout == 0 {
+		r.timeout = defaultOrdererChangeTimeout
+	}
+	return nil
+}
+
+func (r *upgradeCapabilitiesRequest) targets() map[string]string {
+	targets := make(map[string]string)
+	if r.ChannelCapability != "" {
+		targets[channelGroupPath] = r.ChannelCapability
+	}
+	if r.OrdererCapability != "" {
+		targets[ordererGroupPath] = r.OrdererCapability
+	}
+	if r.ApplicationCapability != "" {
+		targets[applicationGroupPath] = r.ApplicationCapability
+	}
+	return targets
+}
+
+// capabilityChange is the progress of one group upgrade on one channel.
+type capabilityChange struct {
+	ChannelID   string   `json:"channelID"`
+	Group       string   `json:"group"`
+	Before      []string `json:"before,omitempty"`
+	After       string   `json:"after"`
+	Status      string   `json:"status"`
+	TxID        string   `json:"txID,omitempty"`
+	BlockNumber *uint64  `json:"blockNumber,omitempty"`
+	Error       string   `json:"error,omitempty"`
+	// DryRun is the previewed update of a dry run
+	DryRun *configProposal `json:"dryRun,omitempty"`
+}
+
+type upgradeCapabilitiesResult struct {
+	Completed bool                `json:"completed"`
+	Nodes     []nodeVersion       `json:"nodes,omitempty"`
+	Changes   []*capabilityChange `json:"changes"`
+}
+
+// capabilities serves GET /network/capabilities, the report, and POST, the upgrade.
+func capabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		identity, orderer := configQuery(r)
+		c := capabilityChannels{SystemChannel: q.Get("systemChannel"), SkipSystemChannel: q.Get("skipSystemChannel") == "true", OperationsCACert: q.Get("operationsCACert")}
+		for _, field := range []string{"channels", "operationsEndpoints"} {
+			for _, v := range q[field] {
+				for _, s := range strings.Split(v, ",") {
+					if s = strings.TrimSpace(s); s == "" {
+						continue
+					}
+					if field == "channels" {
+						c.Channels = append(c.Channels, s)
+					} else {
+						c.OperationsEndpoints = append(c.OperationsEndpoints, s)
+					}
+				}
+			}
+		}
+		if err := c.validate(); err != nil {
+			writeError(w, badRequest("invalid request: %v", err))
+			return
+		}
+		result, err := doCapabilityReport(sdkProfileOf(r), identity, &c, orderer)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{Result: result})
+		return
+	}
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	req := upgradeCapabilitiesRequest{dryRun: dryRun}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doUpgradeCapabilities(sdkProfileOf(r), &req)
+	if err != nil && result == nil {
+		writeError(w, err)
+		return
+	}
+	if err != nil {
+		// report how far it got together with the error
+		log.Println(err.Error())
+		writeResponse(w, apiResponse{Result: result, Error: &apiError{Status: http.StatusInternalServerError, Message: err.Error()}})
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doCapabilityReport(profile sdkProfile, identity identityRequest, c *capabilityChannels, orderer string) (result *capabilityReport, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	result = &capabilityReport{Channels: []channelCapabilities{}}
+	for _, ch := range c.list() {
+		cc := channelCapabilities{ChannelID: ch}
+		_, config, err := queryChannelConfig(sdk, identity, ch, orderer)
+		if err == nil {
+			err = cc.fill(config)
+		}
+		if err != nil {
+			cc.Error = err.Error()
+		}
+		result.Channels = append(result.Channels, cc)
+	}
+	if len(c.OperationsEndpoints) > 0 {
+		if result.Nodes, err = c.nodeVersions(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (cc *channelCapabilities) fill(config *common.Config) error {
+	var err error
+	root := config.ChannelGroup
+	if cc.Channel, err = groupCapabilities(root); err != nil {
+		return err
+	}
+	if cc.Orderer, err = groupCapabilities(root.Groups[ordererGroupKey]); err != nil {
+		return err
+	}
+	if app := root.Groups[applicationGroupKey]; app != nil {
+		if cc.Application, err = groupCapabilities(app); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeVersions asks every operations endpoint for its /version.
+func (c *capabilityChannels) nodeVersions() ([]nodeVersion, error) {
+	tlsConfig := &tls.Config{}
+	if c.OperationsCACert != "" {
+		data, err := ioutil.ReadFile(c.OperationsCACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return nil, badRequest("%s has no PEM certificates", c.OperationsCACert)
+		}
+	}
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	var nodes []nodeVersion
+	for _, ep := range c.OperationsEndpoints {
+		node := nodeVersion{Endpoint: ep}
+		if err := getNodeVersion(client, &node); err != nil {
+			node.Error = err.Error()
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func getNodeVersion(client *http.Client, node *nodeVersion) error {
+	resp, err := client.Get(strings.TrimSuffix(node.Endpoint, "/") + "/version")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/version returned %s", resp.Status)
+	}
+	var v struct {
+		Version string `json:"Version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return fmt.Errorf("invalid /version response: %v", err)
+	}
+	node.Version = v.Version
+	return nil
+}
+
+// parseVersion turns 2.5.4 or v2.5.4-snapshot into [2 5 4].
+func parseVersion(s string) ([]int, error) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	v := []int{0, 0, 0}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func doUpgradeCapabilities(profile sdkProfile, req *upgradeCapabilitiesRequest) (result *upgradeCapabilitiesResult, err error) {
+	result = &upgradeCapabilitiesResult{Changes: []*capabilityChange{}}
+
+	// every node has to run a release that knows the new capabilities, or it stops processing the channel
+	if len(req.OperationsEndpoints) > 0 {
+		if result.Nodes, err = req.nodeVersions(); err != nil {
+			return nil, err
+		}
+		var required string
+		for _, c := range req.targets() {
+			if required == "" || compareCapabilities(c, required) > 0 {
+				required = c
+			}
+		}
+		var old []string
+		for _, node := range result.Nodes {
+			if node.Error != "" {
+				old = append(old, fmt.Sprintf("%s (%s)", node.Endpoint, node.Error))
+				continue
+			}
+			v, err := parseVersion(node.Version)
+			if err != nil || compareVersions(v, capabilityVersion(required)) < 0 {
+				old = append(old, fmt.Sprintf("%s (%s)", node.Endpoint, node.Version))
+			}
+		}
+		if len(old) > 0 {
+			return nil, badRequest("%s needs fabric %s or later, which is not confirmed for %s", required,
+				strings.Replace(strings.TrimPrefix(required, "V"), "_", ".", -1), strings.Join(old, ", "))
+		}
+	}
+
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	// plan, and refuse downgrades, before anything is changed
+	targets := req.targets()
+	for _, ch := range req.list() {
+		_, config, err := queryChannelConfig(sdk, req.identityRequest, ch, req.Orderer)
+		if err != nil {
+			return nil, err
+		}
+		// orderer, then channel, then application, as in the fabric upgrade docs
+		for _, path := range []string{ordererGroupPath, channelGroupPath, applicationGroupPath} {
+			target, ok := targets[path]
+			group := lookupConfigGroup(config.ChannelGroup, path)
+			if !ok || group == nil {
+				continue
+			}
+			before, err := groupCapabilities(group)
+			if err != nil {
+				return nil, err
+			}
+			c := &capabilityChange{ChannelID: ch, Group: path, Before: before, After: target, Status: changeSkipped}
+			if len(before) == 1 && before[0] == target {
+				c.Status = changeUnchanged
+			}
+			for _, b := range before {
+				if compareCapabilities(b, target) > 0 {
+					return nil, badRequest("%s %s is at %s, capabilities cannot be downgraded to %s", ch, path, b, target)
+				}
+			}
+			result.Changes = append(result.Changes, c)
+		}
+	}
+
+	var planned map[string]*common.Config
+	if req.dryRun {
+		planned = make(map[string]*common.Config)
+	}
+	for _, c := range result.Changes {
+		if c.Status == changeUnchanged {
+			continue
+		}
+		if err := upgradeCapability(sdk, req, c, planned); err != nil {
+			c.Status = changeFailed
+			c.Error = err.Error()
+			return result, fmt.Errorf("failed to upgrade %s of channel %s to %s: %v", c.Group, c.ChannelID, c.After, err)
+		}
+		if !req.dryRun {
+			log.Printf("upgraded %s of channel %s to %s\n", c.Group, c.ChannelID, c.After)
+		}
+	}
+	result.Completed = true
+	return result, nil
+}
+
+func upgradeCapability(sdk *pooledSDK, req *upgradeCapabilitiesRequest, c *capabilityChange, planned map[string]*common.Config) error {
+	block, config, err := plannedChannelConfig(sdk, req.identityRequest, c.ChannelID, req.Orderer, planned)
+	if err != nil {
+		return err
+	}
+	op := configOperation{Op: opSetCapability, Path: c.Group, Capability: c.After}
+	tx, err := applyConfigOperations(c.ChannelID, config, []configOperation{op})
+	if err != nil {
+		return err
+	}
+	if req.dryRun {
+		p, updated, err := dryRunConfigUpdate(sdk, req.identityRequest, req.Signers, c.ChannelID, req.Orderer, config, tx)
+		if err != nil {
+			return err
+		}
+		planned[c.ChannelID] = updated
+		c.DryRun, c.Status = p, changePlanned
+		return nil
+	}
+	txID, blockNumber, err := commitConfigUpdate(sdk, req.identityRequest, req.Signers, c.ChannelID, req.Orderer, req.timeout, block, config, tx, func(config *common.Config) (bool, error) {
+		caps, err := groupCapabilities(lookupConfigGroup(config.ChannelGroup, c.Group))
+		if err != nil {
+			return false, err
+		}
+		return len(caps) == 1 && caps[0] == c.After, nil
+	})
+	c.TxID = txID
+	if err != nil {
+		return err
+	}
+	c.BlockNumber = &blockNumber
+	c.Status = changeCommitted
+	return nil
+}
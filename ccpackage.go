@@ -0,0 +1,474 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	lcpackager "github.com/hyperledger/fabric-sdk-go/pkg/fab/ccpackager/lifecycle"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+const (
+	maxChaincodeUploadSize = 100 << 20
+
+	packageMetadataFile = "metadata.json"
+	packageCodeFile     = "code.tar.gz"
+)
+
+// same rule the peer applies to package labels
+var packageLabelRegexp = regexp.MustCompile(`^[[:alnum:]][[:alnum:]_.+-]*$`)
+
+// chaincode types a peer accepts in metadata.json, ccaas and external run outside the peer
+var packageTypes = map[string]bool{
+	"golang":   true,
+	"node":     true,
+	"java":     true,
+	"car":      true,
+	"ccaas":    true,
+	"external": true,
+}
+
+// uploadChaincodeRequest is the multipart form of /chaincode/upload. It carries either "package",
+// a lifecycle package as built by `peer lifecycle chaincode package`, or "source", a .tar.gz of the
+// chaincode source tree together with "language" and "label".
+type uploadChaincodeRequest struct {
+	identityRequest
+	Label    string
+	Language string
+	Peers    []string
+
+	pkg    []byte
+	source []byte
+	ccType pb.ChaincodeSpec_Type
+}
+
+func (r *uploadChaincodeRequest) validate() error {
+	r.setDefaults()
+	switch {
+	case r.pkg == nil && r.source == nil:
+		return fmt.Errorf("package or source is required")
+	case r.pkg != nil && r.source != nil:
+		return fmt.Errorf("package and source are mutually exclusive")
+	case r.pkg != nil:
+		if r.Language != "" {
+			return fmt.Errorf("language is taken from the package metadata")
+		}
+		md, err := parseChaincodePackage(r.pkg)
+		if err != nil {
+			return err
+		}
+		if r.Label != "" && r.Label != md.Label {
+			return fmt.Errorf("label %q does not match package label %q", r.Label, md.Label)
+		}
+		r.Label = md.Label
+		return nil
+	}
+	if r.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	if !packageLabelRegexp.MatchString(r.Label) {
+		return fmt.Errorf("invalid label %q", r.Label)
+	}
+	if r.Language == "" {
+		return fmt.Errorf("language is required")
+	}
+	ccType, err := parseChaincodeType(r.Language)
+	if err != nil {
+		return err
+	}
+	r.ccType = ccType
+	return nil
+}
+
+func decodeUploadRequest(w http.ResponseWriter, r *http.Request, req *uploadChaincodeRequest) error {
+	if r.Method != http.MethodPost {
+		return &apiError{Status: http.StatusMethodNotAllowed, Message: fmt.Sprintf("method %s not allowed", r.Method)}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxChaincodeUploadSize)
+	if err := r.ParseMultipartForm(maxChaincodeUploadSize); err != nil {
+		return badRequest("invalid multipart form: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+	for key, values := range r.MultipartForm.Value {
+		switch key {
+		case "org":
+			req.Org = values[0]
+		case "user":
+			req.User = values[0]
+		case "label":
+			req.Label = values[0]
+		case "language":
+			req.Language = values[0]
+		case "peers":
+			// repeated fields or a comma separated list
+			for _, v := range values {
+				for _, peer := range strings.Split(v, ",") {
+					if peer = strings.TrimSpace(peer); peer != "" {
+						req.Peers = append(req.Peers, peer)
+					}
+				}
+			}
+		default:
+			return badRequest("invalid multipart form: unknown field %q", key)
+		}
+	}
+	for key, files := range r.MultipartForm.File {
+		data, err := readFormFile(files[0])
+		if err != nil {
+			return badRequest("invalid multipart form: %s: %v", key, err)
+		}
+		switch key {
+		case "package":
+			req.pkg = data
+		case "source":
+			req.source = data
+		default:
+			return badRequest("invalid multipart form: unknown file %q", key)
+		}
+	}
+	if err := req.validate(); err != nil {
+		return badRequest("invalid request: %v", err)
+	}
+	return nil
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// parseChaincodePackage checks that pkg is a lifecycle package: a .tar.gz holding metadata.json and code.tar.gz.
+func parseChaincodePackage(pkg []byte) (*lcpackager.PackageMetadata, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(pkg))
+	if err != nil {
+		return nil, fmt.Errorf("package is not gzip compressed: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	var md *lcpackager.PackageMetadata
+	hasCode := false
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid package archive: %v", err)
+		}
+		switch hdr.Name {
+		case packageMetadataFile:
+			md = &lcpackager.PackageMetadata{}
+			if err := json.NewDecoder(tr).Decode(md); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", packageMetadataFile, err)
+			}
+		case packageCodeFile:
+			hasCode = true
+		}
+	}
+	if md == nil {
+		return nil, fmt.Errorf("package has no %s", packageMetadataFile)
+	}
+	if !hasCode {
+		return nil, fmt.Errorf("package has no %s", packageCodeFile)
+	}
+	if !packageLabelRegexp.MatchString(md.Label) {
+		return nil, fmt.Errorf("invalid package label %q", md.Label)
+	}
+	if !packageTypes[strings.ToLower(md.Type)] {
+		return nil, fmt.Errorf("unsupported package type %q", md.Type)
+	}
+	return md, nil
+}
+
+// extractTarGz unpacks a .tar.gz archive into dir, refusing entries that would land outside of it.
+func extractTarGz(data []byte, dir string) error {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("archive is not gzip compressed: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid archive: %v", err)
+		}
+		target := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s in archive", hdr.Name)
+		}
+	}
+}
+
+const defaultCCaaSDialTimeout = "10s"
+
+// ccaasRequest describes a chaincode running as an external service. It becomes the connection.json
+// read by the peer's ccaas external builder.
+type ccaasRequest struct {
+	Address            string `json:"address"`
+	DialTimeout        string `json:"dialTimeout,omitempty"`
+	TLSRequired        bool   `json:"tlsRequired,omitempty"`
+	ClientAuthRequired bool   `json:"clientAuthRequired,omitempty"`
+	ClientCert         string `json:"clientCert,omitempty"` // PEM
+	ClientKey          string `json:"clientKey,omitempty"`  // PEM
+	RootCert           string `json:"rootCert,omitempty"`   // PEM
+}
+
+func (r *ccaasRequest) validate() error {
+	if r.Address == "" {
+		return fmt.Errorf("ccaas address is required")
+	}
+	if r.DialTimeout == "" {
+		r.DialTimeout = defaultCCaaSDialTimeout
+	}
+	if _, err := parseTimeout("ccaas dialTimeout", r.DialTimeout); err != nil {
+		return err
+	}
+	if r.TLSRequired && r.RootCert == "" {
+		return fmt.Errorf("ccaas rootCert is required with tlsRequired")
+	}
+	if r.ClientAuthRequired {
+		if !r.TLSRequired {
+			return fmt.Errorf("ccaas clientAuthRequired needs tlsRequired")
+		}
+		if r.ClientCert == "" || r.ClientKey == "" {
+			return fmt.Errorf("ccaas clientCert and clientKey are required with clientAuthRequired")
+		}
+	}
+	return nil
+}
+
+// newCCaaSPackage builds a lifecycle package whose code.tar.gz only holds connection.json.
+// The archive carries no timestamps, so the same input always gives the same package ID.
+func newCCaaSPackage(label string, r *ccaasRequest) ([]byte, error) {
+	if !packageLabelRegexp.MatchString(label) {
+		return nil, fmt.Errorf("invalid label %q", label)
+	}
+	connection, err := json.Marshal(map[string]interface{}{
+		"address":              r.Address,
+		"dial_timeout":         r.DialTimeout,
+		"tls_required":         r.TLSRequired,
+		"client_auth_required": r.ClientAuthRequired,
+		"client_key":           r.ClientKey,
+		"client_cert":          r.ClientCert,
+		"root_cert":            r.RootCert,
+	})
+	if err != nil {
+		return nil, err
+	}
+	code, err := tarGz(tarEntry{name: "connection.json", data: connection})
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := json.Marshal(map[string]string{"type": "ccaas", "label": label})
+	if err != nil {
+		return nil, err
+	}
+	return tarGz(tarEntry{name: packageMetadataFile, data: metadata}, tarEntry{name: packageCodeFile, data: code})
+}
+
+type tarEntry struct {
+	name string
+	data []byte
+	mode int64 // 0644 if not set
+}
+
+func tarGz(entries ...tarEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Size: int64(len(e.data)), Mode: 0100000 | mode}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chaincodeSource is where a package is built from: a source path on the gateway host, or a ccaas endpoint.
+type chaincodeSource struct {
+	Path     string        `json:"path,omitempty"`
+	Language string        `json:"language,omitempty"`
+	CCaaS    *ccaasRequest `json:"ccaas,omitempty"`
+
+	ccType pb.ChaincodeSpec_Type
+}
+
+func (s *chaincodeSource) validate() error {
+	switch {
+	case s.Path == "" && s.CCaaS == nil:
+		return fmt.Errorf("path or ccaas is required")
+	case s.Path != "" && s.CCaaS != nil:
+		return fmt.Errorf("path and ccaas are mutually exclusive")
+	case s.CCaaS != nil:
+		if s.Language != "" {
+			return fmt.Errorf("language does not apply to ccaas")
+		}
+		return s.CCaaS.validate()
+	}
+	ccType, err := parseChaincodeType(s.Language)
+	if err != nil {
+		return err
+	}
+	s.ccType = ccType
+	return nil
+}
+
+func (s *chaincodeSource) newPackage(label string) ([]byte, error) {
+	if s.CCaaS != nil {
+		return newCCaaSPackage(label, s.CCaaS)
+	}
+	return lcpackager.NewCCPackage(&lcpackager.Descriptor{Path: s.Path, Type: s.ccType, Label: label})
+}
+
+// packageIDRequest computes the ID a package would be installed under, e.g. to start a ccaas
+// container with CHAINCODE_ID before the definition is committed.
+type packageIDRequest struct {
+	identityRequest
+	chaincodeSource
+	Label string `json:"label"`
+}
+
+func (r *packageIDRequest) validate() error {
+	r.setDefaults()
+	if r.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	return r.chaincodeSource.validate()
+}
+
+type packageIDResult struct {
+	PackageID string `json:"packageID"`
+}
+
+func computePackageID(w http.ResponseWriter, r *http.Request) {
+	var req packageIDRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doComputePackageID(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doComputePackageID(profile sdkProfile, req *packageIDRequest) (result *packageIDResult, err error) {
+	ccPkg, err := req.newPackage(req.Label)
+	if err != nil {
+		return nil, err
+	}
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	cc, err := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client context: %v", err)
+	}
+	return &packageIDResult{PackageID: lcpackager.ComputePackageIDWithHashOpts(req.Label, ccPkg, cc.SigningManager().GetHashOpts())}, nil
+}
+
+func uploadChaincode(w http.ResponseWriter, r *http.Request) {
+	var req uploadChaincodeRequest
+	if err := decodeUploadRequest(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doUploadChaincode(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doUploadChaincode(profile sdkProfile, req *uploadChaincodeRequest) (result *installChaincodeResult, err error) {
+	if req.pkg == nil {
+		dir, err := ioutil.TempDir("", "chaincode-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		if err := extractTarGz(req.source, dir); err != nil {
+			return nil, badRequest("%v", err)
+		}
+		req.pkg, err = lcpackager.NewCCPackage(&lcpackager.Descriptor{Path: dir, Type: req.ccType, Label: req.Label})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client context: %v", err)
+	}
+	// SHA2 or SM3, whichever the profile is configured for
+	packageID := lcpackager.ComputePackageIDWithHashOpts(req.Label, req.pkg, cc.SigningManager().GetHashOpts())
+	resp, err := resMgmtClient.LifecycleInstallCC(resmgmt.LifecycleInstallCCRequest{Label: req.Label, Package: req.pkg}, targetOpts(req.Peers)...)
+	if err != nil {
+		return nil, err
+	}
+	return &installChaincodeResult{PackageID: packageID, Installed: resp}, nil
+}
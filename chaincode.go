@@ -2,199 +2,611 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	lcpackager "github.com/hyperledger/fabric-sdk-go/pkg/fab/ccpackager/lifecycle"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
-	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
 )
 
-var (
-	chaincodeID              = "basic001"
-	chaincodeLabel           = "label_" + chaincodeID // label 是 LifecycleInstallCC 的唯一标识
-	chaincodeVersion         = "1.0"
-	chaincodeInitialSequence = int64(1)
-	chaincodeGoPath          = "/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/asset-transfer-basic/chaincode-go"
+const (
+	defaultChaincodeSequence = int64(1)
 
-	peerEndpoint = "peer0.org1.example.com"
-	orgMSP       = "Org1MSP"
+	argsEncodingString = "string"
+	argsEncodingBase64 = "base64"
 )
 
-func deployChaincode(w http.ResponseWriter, r *http.Request) {
+type deployChaincodeRequest struct {
+	identityRequest
+	chaincodeDefinition
+	chaincodeSource
+	ChannelID string   `json:"channelID"`
+	Label     string   `json:"label,omitempty"` // label 是 LifecycleInstallCC 的唯一标识
+	Peers     []string `json:"peers,omitempty"`
+	Orderer   string   `json:"orderer,omitempty"`
+}
+
+func (r *deployChaincodeRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if err := r.chaincodeDefinition.validate(); err != nil {
+		return err
+	}
+	if err := r.chaincodeSource.validate(); err != nil {
+		return err
+	}
+	if r.Label == "" {
+		r.Label = "label_" + r.Name
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// upgradeChaincodeRequest upgrades a committed chaincode to the next sequence. Fields left empty keep
+// their committed value. The new code is given either as a path or ccaas endpoint to package, or as the
+// ID of a package installed beforehand; with neither, the package this org approved last is kept.
+type upgradeChaincodeRequest struct {
+	identityRequest
+	chaincodeSource
+	endorsementPolicy
+	ChannelID    string              `json:"channelID"`
+	Name         string              `json:"name"`
+	Version      string              `json:"version,omitempty"`
+	PackageID    string              `json:"packageID,omitempty"`
+	Label        string              `json:"label,omitempty"`
+	Collections  []collectionRequest `json:"collections,omitempty"`
+	InitRequired *bool               `json:"initRequired,omitempty"`
+	Peers        []string            `json:"peers"`
+	Orderer      string              `json:"orderer,omitempty"`
+
+	collections []*pb.CollectionConfig
+}
+
+func (r *upgradeChaincodeRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Path != "" || r.CCaaS != nil {
+		if r.PackageID != "" {
+			return fmt.Errorf("packageID is mutually exclusive with path and ccaas")
+		}
+		if err := r.chaincodeSource.validate(); err != nil {
+			return err
+		}
+	}
+	if len(r.Peers) == 0 {
+		return fmt.Errorf("peers is required")
+	}
+	if err := r.endorsementPolicy.validate(); err != nil {
+		return err
+	}
+	if r.Label == "" {
+		r.Label = "label_" + r.Name
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	collections, err := collectionConfigs(r.Collections)
+	if err != nil {
+		return err
+	}
+	r.collections = collections
+	return nil
+}
+
+// invokeChaincodeRequest is the body of /chaincode/invoke and /chaincode/query.
+// With argsEncoding "base64" args and transient values are base64 encoded, and so is the returned payload.
+// waitFor and commitTimeout only apply to invoke.
+type invokeChaincodeRequest struct {
+	identityRequest
+	ChannelID          string            `json:"channelID"`
+	ChaincodeID        string            `json:"chaincodeID"`
+	Function           string            `json:"function"`
+	Args               []string          `json:"args,omitempty"`
+	ArgsEncoding       string            `json:"argsEncoding,omitempty"`
+	Transient          map[string]string `json:"transient,omitempty"` // private data, not written to the ledger
+	Peers              []string          `json:"peers,omitempty"`
+	EndorsementTimeout string            `json:"endorsementTimeout,omitempty"`
+	WaitFor            string            `json:"waitFor,omitempty"` // one, all or none of the endorsing peers
+	CommitTimeout      string            `json:"commitTimeout,omitempty"`
+
+	args        [][]byte
+	transient   map[string][]byte
+	endorseWait time.Duration
+	commitWait  time.Duration
+}
+
+func (r *invokeChaincodeRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if r.ChaincodeID == "" {
+		return fmt.Errorf("chaincodeID is required")
+	}
+	if r.Function == "" {
+		return fmt.Errorf("function is required")
+	}
+	var decode func(string) ([]byte, error)
+	switch r.ArgsEncoding {
+	case "", argsEncodingString:
+		r.ArgsEncoding = argsEncodingString
+		decode = func(s string) ([]byte, error) { return []byte(s), nil }
+	case argsEncodingBase64:
+		decode = base64.StdEncoding.DecodeString
+	default:
+		return fmt.Errorf("unsupported argsEncoding %q", r.ArgsEncoding)
+	}
+	r.args = make([][]byte, 0, len(r.Args))
+	for i, arg := range r.Args {
+		b, err := decode(arg)
+		if err != nil {
+			return fmt.Errorf("args[%d]: %v", i, err)
+		}
+		r.args = append(r.args, b)
+	}
+	if len(r.Transient) > 0 {
+		r.transient = make(map[string][]byte, len(r.Transient))
+		for k, v := range r.Transient {
+			b, err := decode(v)
+			if err != nil {
+				return fmt.Errorf("transient[%s]: %v", k, err)
+			}
+			r.transient[k] = b
+		}
+	}
+	switch r.WaitFor {
+	case "":
+		r.WaitFor = commitWaitOne
+	case commitWaitOne, commitWaitAll, commitWaitNone:
+	default:
+		return fmt.Errorf("unsupported waitFor %q", r.WaitFor)
+	}
 	var err error
-	if strings.HasPrefix(r.RequestURI, "/gm") {
-		err = doDeployChaincode(gmConfigFilePath)
-	} else {
-		err = doDeployChaincode(configFilePath)
+	if r.endorseWait, err = parseTimeout("endorsementTimeout", r.EndorsementTimeout); err != nil {
+		return err
+	}
+	if r.commitWait, err = parseTimeout("commitTimeout", r.CommitTimeout); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *invokeChaincodeRequest) channelRequest() (channel.Request, []channel.RequestOption) {
+	var opts []channel.RequestOption
+	if len(r.Peers) > 0 {
+		opts = append(opts, channel.WithTargetEndpoints(r.Peers...))
+	}
+	if r.endorseWait > 0 {
+		opts = append(opts, channel.WithTimeout(fab.PeerResponse, r.endorseWait))
+	}
+	return channel.Request{
+		ChaincodeID:  r.ChaincodeID,
+		Fcn:          r.Function,
+		Args:         r.args,
+		TransientMap: r.transient,
+	}, opts
+}
+
+type deployChaincodeResult struct {
+	PackageID   string          `json:"packageID"`
+	ApproveTxID string          `json:"approveTxID"`
+	Approvals   map[string]bool `json:"approvals"`
+}
+
+type upgradeChaincodeResult struct {
+	PackageID         string                               `json:"packageID"`
+	Version           string                               `json:"version"`
+	Sequence          int64                                `json:"sequence"`
+	CodeChanged       bool                                 `json:"codeChanged"`
+	DefinitionChanged bool                                 `json:"definitionChanged"`
+	Installed         []resmgmt.LifecycleInstallCCResponse `json:"installed,omitempty"`
+	ApproveTxID       string                               `json:"approveTxID"`
+	Approvals         map[string]bool                      `json:"approvals"`
+	// Committed is false while other orgs still have to approve the new sequence
+	Committed bool `json:"committed"`
+}
+
+type invokeChaincodeResult struct {
+	Payload        string                `json:"payload"`
+	ValidationCode string                `json:"validationCode,omitempty"`
+	Endorsements   []endorsementResponse `json:"endorsements"`
+	Commits        []commitStatus        `json:"commits,omitempty"`
+}
+
+type endorsementResponse struct {
+	Endorser        string `json:"endorser"`
+	Status          int32  `json:"status"`
+	ChaincodeStatus int32  `json:"chaincodeStatus"`
+	Message         string `json:"message,omitempty"`
+}
+
+func newInvokeChaincodeResult(req *invokeChaincodeRequest, resp *channel.Response, commits []commitStatus) invokeChaincodeResult {
+	result := invokeChaincodeResult{Payload: string(resp.Payload), Commits: commits}
+	if req.ArgsEncoding == argsEncodingBase64 {
+		result.Payload = base64.StdEncoding.EncodeToString(resp.Payload)
+	}
+	// queries and invokes with waitFor none never see a commit event, so there is no validation code
+	if len(commits) > 0 {
+		result.ValidationCode = resp.TxValidationCode.String()
+	}
+	for _, r := range resp.Responses {
+		e := endorsementResponse{
+			Endorser:        r.Endorser,
+			Status:          r.Status,
+			ChaincodeStatus: r.ChaincodeStatus,
+		}
+		if r.ProposalResponse != nil && r.Response != nil {
+			e.Message = r.Response.Message
+		}
+		result.Endorsements = append(result.Endorsements, e)
+	}
+	return result
+}
+
+// parseChaincodeType maps a chaincode language name to its spec type, defaulting to golang.
+func parseChaincodeType(lang string) (pb.ChaincodeSpec_Type, error) {
+	switch strings.ToLower(lang) {
+	case "", "go", "golang":
+		return pb.ChaincodeSpec_GOLANG, nil
+	case "node", "javascript", "typescript":
+		return pb.ChaincodeSpec_NODE, nil
+	case "java":
+		return pb.ChaincodeSpec_JAVA, nil
+	}
+	return pb.ChaincodeSpec_UNDEFINED, fmt.Errorf("unsupported chaincode language %q", lang)
+}
+
+func deployChaincode(w http.ResponseWriter, r *http.Request) {
+	var req deployChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	txID, result, err := doDeployChaincode(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{TxID: string(txID), Result: result})
+}
+
+func upgradeChaincode(w http.ResponseWriter, r *http.Request) {
+	var req upgradeChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
 	}
+	txID, result, err := doUpgradeChaincode(sdkProfileOf(r), &req)
 	if err != nil {
-		log.Println(err.Error())
-		io.WriteString(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	io.WriteString(w, "deploy chaincode ok")
+	writeResponse(w, apiResponse{TxID: string(txID), Result: result})
 }
 
 func invokeChaincode(w http.ResponseWriter, r *http.Request) {
-	var err error
-	var resp []byte
-	if strings.HasPrefix(r.RequestURI, "/gm") {
-		resp, err = doInvokeChaincode(gmConfigFilePath)
-	} else {
-		resp, err = doInvokeChaincode(configFilePath)
+	var req invokeChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
 	}
+	resp, commits, err := doInvokeChaincode(sdkProfileOf(r), &req)
 	if err != nil {
-		log.Println(err.Error())
-		io.WriteString(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	io.WriteString(w, string(resp))
+	var blockNumber *uint64
+	if len(commits) > 0 {
+		blockNumber = &commits[0].BlockNumber
+	}
+	writeResponse(w, apiResponse{
+		TxID:        string(resp.TransactionID),
+		BlockNumber: blockNumber,
+		Result:      newInvokeChaincodeResult(&req, resp, commits),
+	})
 }
 
-func doDeployChaincode(sdkConfigFilePath string) error {
-	sdk, err := fabsdk.New(config.FromFile(sdkConfigFilePath))
+func queryChaincode(w http.ResponseWriter, r *http.Request) {
+	var req invokeChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, err := doQueryChaincode(sdkProfileOf(r), &req)
 	if err != nil {
-		return err
+		writeError(w, err)
+		return
 	}
-	defer sdk.Close()
-	clientContext := sdk.Context(fabsdk.WithUser(sdkAdmin), fabsdk.WithOrg(sdkOrg))
-	if clientContext == nil {
-		return fmt.Errorf("failed to create client context based on organization name and administrator user")
+	writeResponse(w, apiResponse{TxID: string(resp.TransactionID), Result: newInvokeChaincodeResult(&req, resp, nil)})
+}
+
+func doDeployChaincode(profile sdkProfile, req *deployChaincodeRequest) (txID fab.TransactionID, result *deployChaincodeResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return "", nil, err
 	}
-	resMgmtClient, err := resmgmt.New(clientContext)
+	defer sdk.release(&err)
+	clientContext := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
 	if err != nil {
-		return fmt.Errorf("failed to create resource management client by client context: %v", err)
+		return "", nil, err
 	}
 
 	// package chaincode
-	desc := &lcpackager.Descriptor{
-		Path:  chaincodeGoPath,
-		Type:  pb.ChaincodeSpec_GOLANG,
-		Label: chaincodeLabel,
-	}
-	ccPkg, err := lcpackager.NewCCPackage(desc)
+	ccPkg, err := req.newPackage(req.Label)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 	installCCReq := resmgmt.LifecycleInstallCCRequest{
-		Label:   chaincodeLabel,
+		Label:   req.Label,
 		Package: ccPkg,
 	}
 
 	cc, err := clientContext()
 	if err != nil {
-		return fmt.Errorf("failed to get client context")
+		return "", nil, fmt.Errorf("failed to get client context")
 	}
 	ho := cc.SigningManager().GetHashOpts()
+	if !req.isSet() {
+		req.EndorsingMSPs = []string{cc.Identifier().MSPID}
+	}
 
 	packageID := lcpackager.ComputePackageIDWithHashOpts(installCCReq.Label, installCCReq.Package, ho)
-	resp, err := resMgmtClient.LifecycleInstallCC(installCCReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	resp, err := resMgmtClient.LifecycleInstallCC(installCCReq, targetOpts(req.Peers)...)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	if packageID == resp[0].PackageID {
-		log.Println("package id matched")
+	if len(resp) == 0 {
+		// nothing is returned when every target peer already has the package, e.g. on a retry
+		log.Printf("chaincode package %s is already installed on all target peers\n", packageID)
 	} else {
-		log.Println("package id mismatched!!!")
-	}
-	// install chaincode
-	ccPkgReturned, err := resMgmtClient.LifecycleGetInstalledCCPackage(resp[0].PackageID, resmgmt.WithTargetEndpoints(peerEndpoint), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
-	if err != nil {
-		return err
-	}
-	if bytes.Equal(ccPkg, ccPkgReturned) {
-		log.Println("package bytes matched")
-	} else {
-		log.Println("package bytes mismatched!!!")
+		if resp[0].PackageID != packageID {
+			return "", nil, fmt.Errorf("peer %s installed package %s, expected %s", resp[0].Target, resp[0].PackageID, packageID)
+		}
+		installed, err := resMgmtClient.LifecycleGetInstalledCCPackage(resp[0].PackageID, resmgmt.WithTargetEndpoints(resp[0].Target), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+		if err != nil {
+			return "", nil, err
+		}
+		if !bytes.Equal(ccPkg, installed) {
+			return "", nil, fmt.Errorf("package %s installed on peer %s differs from the one sent", packageID, resp[0].Target)
+		}
 	}
 	// approve chaincode
-	approveCCReq := resmgmt.LifecycleApproveCCRequest{
-		Name:      chaincodeID,
-		Version:   chaincodeVersion,
-		PackageID: packageID,
-		// PackageID:         resp[0].PackageID, // !!! https://stackoverflow.com/questions/60939652/in-hyperledger-fabric-when-i-try-to-invoke-im-getting-the-following-error-cha
-		Sequence:          chaincodeInitialSequence,
-		EndorsementPlugin: "escc",
-		ValidationPlugin:  "vscc",
-		SignaturePolicy:   policydsl.SignedByAnyMember([]string{orgMSP}),
-		InitRequired:      false,
-	}
-	txnID, err := resMgmtClient.LifecycleApproveCC(channelName, approveCCReq, resmgmt.WithTargetEndpoints(peerEndpoint), resmgmt.WithOrdererEndpoint(ordererEndpoint), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	// PackageID: resp[0].PackageID, // !!! https://stackoverflow.com/questions/60939652/in-hyperledger-fabric-when-i-try-to-invoke-im-getting-the-following-error-cha
+	approveCCReq := req.approveRequest(packageID)
+	txnID, err := resMgmtClient.LifecycleApproveCC(req.ChannelID, approveCCReq, append(targetOpts(req.Peers), resmgmt.WithOrdererEndpoint(req.Orderer))...)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 	log.Printf("approve chaincode tx id: %s\n", txnID)
 	// check commit readiness
-	checkCommitRdReq := resmgmt.LifecycleCheckCCCommitReadinessRequest{
-		Name:              chaincodeID,
-		Version:           chaincodeVersion,
-		EndorsementPlugin: "escc",
-		ValidationPlugin:  "vscc",
-		SignaturePolicy:   policydsl.SignedByAnyMember([]string{orgMSP}),
-		Sequence:          chaincodeInitialSequence,
-		InitRequired:      false,
-	}
-	respcr, err := resMgmtClient.LifecycleCheckCCCommitReadiness(channelName, checkCommitRdReq, resmgmt.WithTargetEndpoints(peerEndpoint), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	respcr, err := resMgmtClient.LifecycleCheckCCCommitReadiness(req.ChannelID, req.readinessRequest(), targetOpts(req.Peers)...)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	log.Printf("%#v\n", respcr)
 	// commit chaincode
-	reqcccr := resmgmt.LifecycleCommitCCRequest{
-		Name:              chaincodeID,
-		Version:           chaincodeVersion,
-		Sequence:          chaincodeInitialSequence,
-		EndorsementPlugin: "escc",
-		ValidationPlugin:  "vscc",
-		SignaturePolicy:   policydsl.SignedByAnyMember([]string{orgMSP}),
-		InitRequired:      false,
+	txnIDccc, err := resMgmtClient.LifecycleCommitCC(req.ChannelID, req.commitRequest(), append(targetOpts(req.Peers), resmgmt.WithOrdererEndpoint(req.Orderer))...)
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("commit chaincode tx id: %s\n", txnIDccc)
+
+	return txnIDccc, &deployChaincodeResult{
+		PackageID:   packageID,
+		ApproveTxID: string(txnID),
+		Approvals:   respcr.Approvals,
+	}, nil
+}
+
+func doUpgradeChaincode(profile sdkProfile, req *upgradeChaincodeRequest) (txID fab.TransactionID, result *upgradeChaincodeResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return "", nil, err
 	}
-	txnIDccc, err := resMgmtClient.LifecycleCommitCC(channelName, reqcccr, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithTargetEndpoints(peerEndpoint), resmgmt.WithOrdererEndpoint(ordererEndpoint))
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	log.Printf("approve chaincode tx id: %s\n", txnIDccc)
-	// check committed chaincode
-	req := resmgmt.LifecycleQueryCommittedCCRequest{
-		Name: chaincodeID,
+
+	// current definition
+	committed, err := resMgmtClient.LifecycleQueryCommittedCC(req.ChannelID, resmgmt.LifecycleQueryCommittedCCRequest{Name: req.Name}, targetOpts(req.Peers)...)
+	if err != nil {
+		return "", nil, err
 	}
-	respqccc, err := resMgmtClient.LifecycleQueryCommittedCC(channelName, req, resmgmt.WithTargetEndpoints(peerEndpoint), resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+	if len(committed) == 0 {
+		return "", nil, badRequest("chaincode %s is not committed on channel %s, deploy it first", req.Name, req.ChannelID)
+	}
+	current := committed[0]
+	var approvedPackageID string
+	approved, err := resMgmtClient.LifecycleQueryApprovedCC(req.ChannelID, resmgmt.LifecycleQueryApprovedCCRequest{Name: req.Name, Sequence: current.Sequence}, targetOpts(req.Peers[:1])...)
 	if err != nil {
-		return err
+		// e.g. an org that joined after the last upgrade
+		log.Printf("no approved definition of %s sequence %d for %s: %v\n", req.Name, current.Sequence, req.Org, err)
+	} else {
+		approvedPackageID = approved.PackageID
 	}
-	log.Printf("%#v\n", respqccc[0])
 
-	return nil
+	// new definition, empty fields keep the committed value
+	def := chaincodeDefinition{
+		Name:         req.Name,
+		Version:      req.Version,
+		Sequence:     current.Sequence + 1,
+		InitRequired: current.InitRequired,
+		collections:  req.collections,
+	}
+	if def.Version == "" {
+		def.Version = current.Version
+	}
+	if req.isSet() {
+		def.endorsementPolicy = req.endorsementPolicy
+	} else {
+		def.endorsementPolicy = endorsementPolicy{ChannelConfigPolicy: current.ChannelConfigPolicy, policy: current.SignaturePolicy}
+	}
+	if req.InitRequired != nil {
+		def.InitRequired = *req.InitRequired
+	}
+	// collections can only be added or updated, never dropped, so none given means keep them all
+	if len(def.collections) == 0 {
+		def.collections = current.CollectionConfig
+	}
+	result = &upgradeChaincodeResult{Version: def.Version, Sequence: def.Sequence}
+	result.DefinitionChanged = def.Version != current.Version ||
+		def.InitRequired != current.InitRequired ||
+		def.ChannelConfigPolicy != current.ChannelConfigPolicy ||
+		!proto.Equal(def.envelope(), current.SignaturePolicy) ||
+		!collectionsEqual(def.collections, current.CollectionConfig)
+
+	// new package
+	var ccPkg []byte
+	switch {
+	case req.Path != "" || req.CCaaS != nil:
+		ccPkg, err = req.newPackage(req.Label)
+		if err != nil {
+			return "", nil, err
+		}
+		cc, err := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))()
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to get client context: %v", err)
+		}
+		result.PackageID = lcpackager.ComputePackageIDWithHashOpts(req.Label, ccPkg, cc.SigningManager().GetHashOpts())
+	case req.PackageID != "":
+		result.PackageID = req.PackageID
+	default:
+		if approvedPackageID == "" {
+			return "", nil, badRequest("no package approved by %s to keep, path, ccaas or packageID is required", req.Org)
+		}
+		result.PackageID = approvedPackageID
+	}
+	result.CodeChanged = result.PackageID != approvedPackageID
+	if !result.CodeChanged && !result.DefinitionChanged {
+		return "", nil, badRequest("chaincode %s sequence %d already matches the requested definition", req.Name, current.Sequence)
+	}
+	// a definition-only change reuses the installed package
+	if result.CodeChanged && ccPkg != nil {
+		// peers that already have the package are skipped by the SDK
+		result.Installed, err = resMgmtClient.LifecycleInstallCC(resmgmt.LifecycleInstallCCRequest{Label: req.Label, Package: ccPkg}, targetOpts(req.Peers)...)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	approveTxID, err := resMgmtClient.LifecycleApproveCC(req.ChannelID, def.approveRequest(result.PackageID), append(targetOpts(req.Peers), resmgmt.WithOrdererEndpoint(req.Orderer))...)
+	if err != nil {
+		return "", nil, err
+	}
+	result.ApproveTxID = string(approveTxID)
+	readiness, err := resMgmtClient.LifecycleCheckCCCommitReadiness(req.ChannelID, def.readinessRequest(), targetOpts(req.Peers)...)
+	if err != nil {
+		return "", nil, err
+	}
+	result.Approvals = readiness.Approvals
+	for _, ok := range readiness.Approvals {
+		if !ok {
+			// the other orgs approve the same definition through /chaincode/approve, then /chaincode/commit
+			return approveTxID, result, nil
+		}
+	}
+	txID, err = resMgmtClient.LifecycleCommitCC(req.ChannelID, def.commitRequest(), append(targetOpts(req.Peers), resmgmt.WithOrdererEndpoint(req.Orderer))...)
+	if err != nil {
+		return "", nil, err
+	}
+	result.Committed = true
+	return txID, result, nil
 }
 
-func doInvokeChaincode(sdkConfigFilePath string) ([]byte, error) {
-	sdk, err := fabsdk.New(config.FromFile(sdkConfigFilePath))
+// collectionsEqual compares collections by name, the order they are listed in does not matter.
+func collectionsEqual(a, b []*pb.CollectionConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	byName := map[string]*pb.CollectionConfig{}
+	for _, c := range a {
+		byName[c.GetStaticCollectionConfig().GetName()] = c
+	}
+	if len(byName) != len(a) {
+		return false
+	}
+	for _, c := range b {
+		name := c.GetStaticCollectionConfig().GetName()
+		if !proto.Equal(byName[name], c) {
+			return false
+		}
+		delete(byName, name)
+	}
+	return true
+}
+
+func doInvokeChaincode(profile sdkProfile, req *invokeChaincodeRequest) (resp *channel.Response, commits []commitStatus, err error) {
+	sdk, err := sdks.acquire(profile)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	defer sdk.release(&err)
+	cc, err := sdk.channelClient(req.ChannelID, req.Org, req.User)
+	if err != nil {
+		return nil, nil, err
 	}
-	defer sdk.Close()
-	channelContext := sdk.ChannelContext(channelName, fabsdk.WithUser(sdkAdmin), fabsdk.WithOrg(sdkOrg))
-	cc, err := channel.New(channelContext)
+	chCtx, err := sdk.ChannelContext(req.ChannelID, fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get channel context: %v", err)
+	}
+	chReq, opts := req.channelRequest()
+	if req.commitWait > 0 {
+		// the execute timeout bounds the whole request, make room for endorsement plus the commit wait
+		endorseWait := req.endorseWait
+		if endorseWait == 0 {
+			endorseWait = chCtx.EndpointConfig().Timeout(fab.PeerResponse)
+		}
+		opts = append(opts, channel.WithTimeout(fab.Execute, endorseWait+req.commitWait))
+	}
+	commit := newCommitHandler(chCtx, req.WaitFor, req.commitWait)
+	handler := invoke.NewSelectAndEndorseHandler(
+		invoke.NewEndorsementValidationHandler(
+			invoke.NewSignatureValidationHandler(commit),
+		),
+	)
+	cr, err := cc.InvokeHandler(handler, chReq, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &cr, commit.commits, nil
+}
+
+func doQueryChaincode(profile sdkProfile, req *invokeChaincodeRequest) (resp *channel.Response, err error) {
+	sdk, err := sdks.acquire(profile)
 	if err != nil {
 		return nil, err
 	}
-	if _, err := cc.Execute(channel.Request{ChaincodeID: chaincodeID, Fcn: "InitLedger"}); err != nil {
+	defer sdk.release(&err)
+	cc, err := sdk.channelClient(req.ChannelID, req.Org, req.User)
+	if err != nil {
 		return nil, err
 	}
-	time.Sleep(2 * time.Second)
-	cr, err := cc.Execute(channel.Request{ChaincodeID: chaincodeID, Fcn: "GetAllAssets"})
+	chReq, opts := req.channelRequest()
+	cr, err := cc.Query(chReq, opts...)
 	if err != nil {
 		return nil, err
 	}
-	return cr.Payload, nil
+	return &cr, nil
 }
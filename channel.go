@@ -3,279 +3,317 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strings"
 
-	"github.com/golang/protobuf/proto"
-	mspclient "github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	pmsp "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource/genesisconfig"
-	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 )
 
-var (
-	channelName       = "mychannel"
-	channelConfigPath = "/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/test-network/channel-artifacts/mychannel.tx"
-
+const (
 	ordererEndpoint = "orderer.example.com"
 	ordererPort     = 7050
 )
 
+type setupChannelRequest struct {
+	identityRequest
+	ChannelID         string `json:"channelID"`
+	ChannelConfigPath string `json:"channelConfigPath,omitempty"`
+	// ChannelConfigArtifact is the id of a channel creation tx in the artifact store
+	ChannelConfigArtifact string   `json:"channelConfigArtifact,omitempty"`
+	Orderer               string   `json:"orderer,omitempty"`
+	Peers                 []string `json:"peers,omitempty"`
+}
+
+func (r *setupChannelRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if (r.ChannelConfigPath == "") == (r.ChannelConfigArtifact == "") {
+		return fmt.Errorf("one of channelConfigPath and channelConfigArtifact is required")
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// updateAnchorPeersRequest is the body of /channel/updateanchorpeers. Like PUT
+// /channel/{channelID}/anchorpeers it replaces the anchor peers of the org in the live config.
+type updateAnchorPeersRequest struct {
+	identityRequest
+	ChannelID    string                `json:"channelID"`
+	Organization anchorPeersOrgRequest `json:"organization"`
+	Orderer      string                `json:"orderer,omitempty"`
+
+	set setAnchorPeersRequest
+}
+
+type anchorPeersOrgRequest struct {
+	Name        string              `json:"name"`
+	AnchorPeers []anchorPeerRequest `json:"anchorPeers"`
+}
+
+func (r *updateAnchorPeersRequest) validate() error {
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if r.Organization.Name == "" {
+		return fmt.Errorf("organization name is required")
+	}
+	r.set = setAnchorPeersRequest{
+		identityRequest: r.identityRequest,
+		Name:            r.Organization.Name,
+		AnchorPeers:     r.Organization.AnchorPeers,
+		Orderer:         r.Orderer,
+		channelID:       r.ChannelID,
+	}
+	return r.set.validate()
+}
+
+// channelResource serves the per-channel routes, /channel/{channelID}/{resource}.
+func channelResource(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/gm"), "/channel/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		writeError(w, &apiError{Status: http.StatusNotFound, Message: fmt.Sprintf("%s is not found", r.URL.Path)})
+		return
+	}
+	switch parts[1] {
+	case "config":
+		channelConfig(w, r, parts[0])
+	case "orgs":
+		channelOrgs(w, r, parts[0])
+	case "anchorpeers":
+		channelAnchorPeers(w, r, parts[0])
+	case "acls":
+		channelACLsHandler(w, r, parts[0])
+	case "policies":
+		channelPolicies(w, r, parts[0])
+	default:
+		writeError(w, &apiError{Status: http.StatusNotFound, Message: fmt.Sprintf("%s is not found", r.URL.Path)})
+	}
+}
+
 func setupChannel(w http.ResponseWriter, r *http.Request) {
-	var err error
-	if strings.HasPrefix(r.RequestURI, "/gm") {
-		err = doSetupChannel(gmConfigFilePath)
-	} else {
-		err = doSetupChannel(configFilePath)
+	var req setupChannelRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
 	}
+	txID, err := doSetupChannel(sdkProfileOf(r), &req)
 	if err != nil {
-		log.Println(err.Error())
-		io.WriteString(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	io.WriteString(w, "channel setup ok")
+	writeResponse(w, apiResponse{TxID: string(txID)})
 }
 
 // create channel and join peers
-func doSetupChannel(sdkConfigFilePath string) error {
-	sdk, err := fabsdk.New(config.FromFile(sdkConfigFilePath))
+func doSetupChannel(profile sdkProfile, req *setupChannelRequest) (txID fab.TransactionID, err error) {
+	sdk, err := sdks.acquire(profile)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer sdk.Close()
+	defer sdk.release(&err)
 
-	clientContext := sdk.Context(fabsdk.WithUser(sdkAdmin), fabsdk.WithOrg(sdkOrg))
-	if clientContext == nil {
-		return fmt.Errorf("failed to create client context based on organization name and administrator user")
-	}
-	// New returns a resource management client instance.
-	resMgmtClient, err := resmgmt.New(clientContext)
+	// resource management client of the request identity, cached by the sdk pool
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
 	if err != nil {
-		return fmt.Errorf("failed to create resource management client by client context: %v", err)
-	}
-	// New creates a new Client instance
-	mspClient, err := mspclient.New(sdk.Context(), mspclient.WithOrg(sdkOrg))
-	if err != nil {
-		return fmt.Errorf("failed to create Org MSP client by specified OrgName: %v", err)
+		return "", err
 	}
 	// Returns: signing identity
-	adminIdentity, err := mspClient.GetSigningIdentity(sdkAdmin)
+	adminIdentity, err := sdk.signingIdentity(req.Org, req.User)
 	if err != nil {
-		return fmt.Errorf("failed to get the signature of the specified ID: %v", err)
+		return "", err
 	}
 	// SaveChannelRequest holds parameters for save channel request
-	channelReq := resmgmt.SaveChannelRequest{ChannelID: channelName, ChannelConfigPath: channelConfigPath, SigningIdentities: []pmsp.SigningIdentity{adminIdentity}}
+	channelReq := resmgmt.SaveChannelRequest{ChannelID: req.ChannelID, ChannelConfigPath: req.ChannelConfigPath, SigningIdentities: []pmsp.SigningIdentity{adminIdentity}}
+	if req.ChannelConfigArtifact != "" {
+		data, err := artifacts.get(req.ChannelConfigArtifact)
+		if err != nil {
+			return "", err
+		}
+		channelReq.ChannelConfig = bytes.NewReader(data)
+	}
 	// save channel response with transaction ID
-	_, err = resMgmtClient.SaveChannel(channelReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(ordererEndpoint))
+	resp, err := resMgmtClient.SaveChannel(channelReq, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(req.Orderer))
 	if err != nil {
-		return fmt.Errorf("failed to create channel: %v", err)
+		return "", fmt.Errorf("failed to create channel: %v", err)
 	}
 	log.Println("Create channel successful")
 
 	// allows for peers to join existing channel with optional custom options (specific peers, filtered peers). If peer(s) are not specified in options it will default to all peers that belong to client's MSP.
-	err = resMgmtClient.JoinChannel(channelName, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(ordererEndpoint))
+	joinOpts := []resmgmt.RequestOption{resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(req.Orderer)}
+	if len(req.Peers) > 0 {
+		joinOpts = append(joinOpts, resmgmt.WithTargetEndpoints(req.Peers...))
+	}
+	err = resMgmtClient.JoinChannel(req.ChannelID, joinOpts...)
 	if err != nil {
-		return fmt.Errorf("peers failed to join channel: %v", err)
+		return "", fmt.Errorf("peers failed to join channel: %v", err)
 	}
 	log.Println("Peers join channel successful")
+	return resp.TransactionID, nil
+}
+
+// createChannelRequest creates a channel from a profile built in memory, no channel creation tx file is needed.
+type createChannelRequest struct {
+	channelCreateTxRequest
+	// Signers sign the channel creation tx, by default the Admin user of every channel org the sdk knows
+	Signers []identityRequest `json:"signers,omitempty"`
+	Orderer string            `json:"orderer,omitempty"`
+	// SkipJoin leaves joining peers to /channel/setup or the orgs themselves
+	SkipJoin bool `json:"skipJoin,omitempty"`
+}
+
+func (r *createChannelRequest) validate() error {
+	if err := r.channelCreateTxRequest.validate(); err != nil {
+		return err
+	}
+	if r.Store {
+		return fmt.Errorf("store is only used by /network/channelcreatetx")
+	}
+	for i := range r.Signers {
+		r.Signers[i].setDefaults()
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
 	return nil
 }
 
-func updateAnchorPeers(w http.ResponseWriter, r *http.Request) {
-	var err error
-	if strings.HasPrefix(r.RequestURI, "/gm") {
-		err = doUpdateAnchorPeers(gmConfigFilePath)
-	} else {
-		err = doUpdateAnchorPeers(configFilePath)
+type createChannelResult struct {
+	ChannelID string   `json:"channelID"`
+	Signers   []string `json:"signers"`
+	Joined    []string `json:"joined,omitempty"`
+}
+
+func createChannel(w http.ResponseWriter, r *http.Request) {
+	var req createChannelRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
 	}
+	txID, result, err := doCreateChannel(sdkProfileOf(r), &req)
 	if err != nil {
-		io.WriteString(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	io.WriteString(w, "anchor peer channel config updated")
+	writeResponse(w, apiResponse{TxID: string(txID), Result: result})
 }
 
-func doUpdateAnchorPeers(sdkConfigFilePath string) error {
-	sdk, err := fabsdk.New(config.FromFile(sdkConfigFilePath))
+func doCreateChannel(profile sdkProfile, req *createChannelRequest) (txID fab.TransactionID, result *createChannelResult, err error) {
+	gp, err := req.createProfile()
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	defer sdk.Close()
-
-	clientContext := sdk.Context(fabsdk.WithUser(sdkAdmin), fabsdk.WithOrg(sdkOrg))
-	if clientContext == nil {
-		return fmt.Errorf("failed to create client context based on organization name and administrator user")
+	cctBytes, err := resource.CreateChannelCreateTx(gp, nil, req.ChannelID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create channel creation tx: %v", err)
 	}
-	// New returns a resource management client instance.
-	resMgmtClient, err := resmgmt.New(clientContext)
+
+	sdk, err := sdks.acquire(profile)
 	if err != nil {
-		return fmt.Errorf("failed to create resource management client by client context: %v", err)
+		return "", nil, err
 	}
+	defer sdk.release(&err)
 
-	mspClient, err := mspclient.New(sdk.Context(), mspclient.WithOrg(sdkOrg))
+	signers := req.Signers
+	if len(signers) == 0 {
+		if signers, err = channelOrgAdmins(sdk, gp); err != nil {
+			return "", nil, err
+		}
+	}
+	result = &createChannelResult{ChannelID: req.ChannelID}
+	var identities []pmsp.SigningIdentity
+	for _, signer := range signers {
+		id, err := sdk.signingIdentity(signer.Org, signer.User)
+		if err != nil {
+			return "", nil, fmt.Errorf("signer %s@%s: %v", signer.User, signer.Org, err)
+		}
+		identities = append(identities, id)
+		result.Signers = append(result.Signers, signer.User+"@"+id.Identifier().MSPID)
+	}
+
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
 	if err != nil {
-		return fmt.Errorf("failed to create Org MSP client by specified OrgName: %v", err)
+		return "", nil, err
 	}
-	adminIdentity, err := mspClient.GetSigningIdentity(sdkAdmin)
+	resp, err := resMgmtClient.SaveChannel(resmgmt.SaveChannelRequest{
+		ChannelID:         req.ChannelID,
+		ChannelConfig:     bytes.NewReader(cctBytes),
+		SigningIdentities: identities,
+	}, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(req.Orderer))
 	if err != nil {
-		return fmt.Errorf("failed to get the signature of the specified ID: %v", err)
+		return "", nil, fmt.Errorf("failed to create channel: %v", err)
+	}
+	log.Printf("Create channel %s successful, signed by %v\n", req.ChannelID, result.Signers)
+	if req.SkipJoin {
+		return resp.TransactionID, result, nil
 	}
 
-	sdkOrg := &genesisconfig.Organization{
-		Name:    "Org1MSP",
-		ID:      "Org1MSP",
-		MSPDir:  sdkOrgMSPDir,
-		MSPType: "bccsp",
-		Policies: map[string]*genesisconfig.Policy{
-			"Admins": {
-				Type: "Signature",
-				Rule: "OR('Org1MSP.admin')",
-			},
-			"Readers": {
-				Type: "Signature",
-				Rule: "OR('Org1MSP.admin', 'Org1MSP.peer', 'Org1MSP.client')",
-			},
-			"Writers": {
-				Type: "Signature",
-				Rule: "OR('Org1MSP.admin', 'Org1MSP.client')",
-			},
-			// "Endorsement": {
-			// 	Type: "Signature",
-			// 	Rule: "OR('Org1MSP.peer')",
-			// },
-		},
-		AnchorPeers: []*genesisconfig.AnchorPeer{
-			{
-				Host: "127.0.0.1",
-				Port: 7051,
-			},
-		},
-	}
-	org2 := &genesisconfig.Organization{
-		Name:    "Org2MSP",
-		ID:      "Org2MSP",
-		MSPDir:  org2MSPDir,
-		MSPType: "bccsp",
-		Policies: map[string]*genesisconfig.Policy{
-			"Admins": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.admin')",
-			},
-			"Readers": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.admin', 'Org2MSP.peer', 'Org2MSP.client')",
-			},
-			"Writers": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.admin', 'Org2MSP.client')",
-			},
-			// "Endorsement": {
-			// 	Type: "Signature",
-			// 	Rule: "OR('Org2MSP.peer')",
-			// },
-		},
-		AnchorPeers: []*genesisconfig.AnchorPeer{
-			{
-				Host: "127.0.0.1",
-				Port: 9051,
-			},
-		},
+	// every signing org joins its own peers
+	joined := make(map[string]bool)
+	for _, signer := range signers {
+		if joined[signer.Org] {
+			continue
+		}
+		joined[signer.Org] = true
+		c, err := sdk.resmgmtClient(signer.Org, signer.User)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := c.JoinChannel(req.ChannelID, resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(req.Orderer)); err != nil {
+			return "", nil, fmt.Errorf("peers of %s failed to join channel: %v", signer.Org, err)
+		}
+		result.Joined = append(result.Joined, signer.Org)
 	}
+	log.Printf("Peers of %v join channel %s successful\n", result.Joined, req.ChannelID)
+	return resp.TransactionID, result, nil
+}
 
-	gp := &genesisconfig.Profile{
-		Consortium: "SampleConsortium",
-		// Policies: map[string]*genesisconfig.Policy{
-		// 	"Admins": {
-		// 		Type: "ImplicitMeta",
-		// 		Rule: "ANY Admins",
-		// 	},
-		// 	"Readers": {
-		// 		Type: "ImplicitMeta",
-		// 		Rule: "ANY Readers",
-		// 	},
-		// 	"Writers": {
-		// 		Type: "ImplicitMeta",
-		// 		Rule: "ANY Writers",
-		// 	},
-		// 	"Endorsement": {
-		// 		Type: "ImplicitMeta",
-		// 		Rule: "ANY Writers",
-		// 	},
-		// },
-		Application: &genesisconfig.Application{
-			ACLs: map[string]string{
-				"_lifecycle/CommitChaincodeDefinition": "/Channel/Application/Writers",
-				"_lifecycle/QueryChaincodeDefinition":  "/Channel/Application/Readers",
-				"_lifecycle/QueryNamespaceDefinitions": "/Channel/Application/Readers",
-				"lscc/ChaincodeExists":                 "/Channel/Application/Readers",
-				"lscc/GetDeploymentSpec":               "/Channel/Application/Readers",
-				"lscc/GetChaincodeData":                "/Channel/Application/Readers",
-				"lscc/GetInstantiatedChaincodes":       "/Channel/Application/Readers",
-				"qscc/GetChainInfo":                    "/Channel/Application/Readers",
-				"qscc/GetBlockByNumber":                "/Channel/Application/Readers",
-				"qscc/GetBlockByHash":                  "/Channel/Application/Readers",
-				"qscc/GetTransactionByID":              "/Channel/Application/Readers",
-				"qscc/GetBlockByTxID":                  "/Channel/Application/Readers",
-				"cscc/GetConfigBlock":                  "/Channel/Application/Readers",
-				"cscc/GetConfigTree":                   "/Channel/Application/Readers",
-				"cscc/SimulateConfigTreeUpdate":        "/Channel/Application/Readers",
-				"peer/Propose":                         "/Channel/Application/Writers",
-				"peer/ChaincodeToChaincode":            "/Channel/Application/Readers",
-				"event/Block":                          "/Channel/Application/Readers",
-				"event/FilteredBlock":                  "/Channel/Application/Readers",
-			},
-			Organizations: []*genesisconfig.Organization{sdkOrg, org2},
-			// Policies: map[string]*genesisconfig.Policy{
-			// 	"LifecycleEndorsement": {
-			// 		Type: "Signature",
-			// 		Rule: "OR('Org1MSP.peer')",
-			// 	},
-			// 	"Endorsement": {
-			// 		Type: "Signature",
-			// 		Rule: "OR('Org1MSP.peer')",
-			// 	},
-			// 	"Readers": {
-			// 		Type: "ImplicitMeta",
-			// 		Rule: "ANY Readers",
-			// 	},
-			// 	"Writers": {
-			// 		Type: "ImplicitMeta",
-			// 		Rule: "ANY Writers",
-			// 	},
-			// 	"Admins": {
-			// 		Type: "ImplicitMeta",
-			// 		Rule: "ANY Admins",
-			// 	},
-			// },
-			Capabilities: map[string]bool{
-				"V2_0": true,
-			},
-		},
-	}
-	apur, err := resource.CreateAnchorPeersUpdate(gp, channelName, orgMSP)
+// channelOrgAdmins maps the application orgs of the profile to the sdk orgs with the same MSP ID.
+func channelOrgAdmins(sdk *pooledSDK, gp *genesisconfig.Profile) ([]identityRequest, error) {
+	cc, err := sdk.Context()()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	sdkOrgs := make(map[string]string)
+	for name, org := range cc.EndpointConfig().NetworkConfig().Organizations {
+		sdkOrgs[org.MSPID] = name
+	}
+	var admins []identityRequest
+	for _, org := range gp.Application.Organizations {
+		name, ok := sdkOrgs[org.ID]
+		if !ok {
+			return nil, badRequest("org %s (%s) is not in the sdk config, give the signers explicitly", org.Name, org.ID)
+		}
+		admins = append(admins, identityRequest{Org: name, User: sdkAdmin})
 	}
-	// fmt.Printf("%#v\n", *apur)
-	apurEnvBytes, err := proto.Marshal(apur)
+	return admins, nil
+}
+
+func updateAnchorPeers(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := isDryRun(r)
 	if err != nil {
-		return err
+		writeError(w, err)
+		return
 	}
-	resp, err := resMgmtClient.SaveChannel(resmgmt.SaveChannelRequest{
-		ChannelID:         channelName,
-		ChannelConfig:     bytes.NewReader(apurEnvBytes),
-		SigningIdentities: []pmsp.SigningIdentity{adminIdentity},
-	}, resmgmt.WithOrdererEndpoint(ordererEndpoint))
+	var req updateAnchorPeersRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	req.set.dryRun = dryRun
+	p, err := doSetAnchorPeers(sdkProfileOf(r), &req.set)
 	if err != nil {
-		return err
+		writeError(w, err)
+		return
 	}
-	log.Printf("%#v\n", resp)
-
-	return nil
+	writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+)
+
+// uploaded msp bundles are kept here, one directory per msp id
+const mspStoreDir = "./msps"
+
+var mspIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// channelOrgRequest is the body of POST /channel/{channelID}/orgs. On an application channel the org
+// joins the application group, on the system channel it joins a consortium.
+type channelOrgRequest struct {
+	identityRequest
+	orgRequest
+	// MSPBundle is a .tar.gz of the org's msp directory, an alternative to mspDir.
+	MSPBundle   []byte `json:"mspBundle,omitempty"`
+	Consortium  string `json:"consortium,omitempty"`
+	Description string `json:"description,omitempty"`
+	TTL         string `json:"ttl,omitempty"`
+	Orderer     string `json:"orderer,omitempty"`
+
+	channelID string
+	ttl       time.Duration
+	dryRun    bool
+}
+
+func (r *channelOrgRequest) validate() error {
+	r.setDefaults()
+	if len(r.MSPBundle) > 0 {
+		if r.MSPDir != "" {
+			return fmt.Errorf("mspDir and mspBundle are mutually exclusive")
+		}
+		if !mspIDPattern.MatchString(r.MSPID) {
+			return fmt.Errorf("invalid org mspID %q", r.MSPID)
+		}
+		r.MSPDir = filepath.Join(mspStoreDir, r.MSPID)
+	}
+	if err := r.orgRequest.validate(); err != nil {
+		return err
+	}
+	ttl, err := parseProposalTTL(r.TTL)
+	if err != nil {
+		return err
+	}
+	r.ttl = ttl
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// channelOrgs serves POST /channel/{channelID}/orgs, adding an org, and
+// DELETE /channel/{channelID}/orgs?name=, removing one. Both answer with the config update proposal.
+func channelOrgs(w http.ResponseWriter, r *http.Request, channelID string) {
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var p *configProposal
+	switch r.Method {
+	case http.MethodDelete:
+		q := r.URL.Query()
+		identity := identityRequest{Org: q.Get("org"), User: q.Get("user")}
+		identity.setDefaults()
+		p, err = doRemoveChannelOrg(sdkProfileOf(r), identity, channelID, q.Get("name"), q.Get("consortium"), q.Get("ttl"), q.Get("orderer"), dryRun)
+	default:
+		req := channelOrgRequest{channelID: channelID, dryRun: dryRun}
+		if err := decodeRequest(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		p, err = doAddChannelOrg(sdkProfileOf(r), &req)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+}
+
+func doAddChannelOrg(profile sdkProfile, req *channelOrgRequest) (p *configProposal, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, req.identityRequest, req.channelID, req.Orderer)
+	if err != nil {
+		return nil, err
+	}
+	root := config.ChannelGroup
+	op := configOperation{Op: opAddApplicationOrgs}
+	members := root.Groups[applicationGroupKey]
+	if consortiums := root.Groups[consortiumsGroupKey]; consortiums != nil {
+		if len(req.AnchorPeers) > 0 {
+			return nil, badRequest("consortium orgs have no anchor peers")
+		}
+		consortium, err := channelConsortium(consortiums.Groups, req.Consortium)
+		if err != nil {
+			return nil, err
+		}
+		op = configOperation{Op: opAddConsortiumOrgs, Consortium: consortium}
+		members = consortiums
+	} else if req.Consortium != "" {
+		return nil, badRequest("consortium is only used on the system channel")
+	}
+	if members != nil {
+		msps := make(map[string]*mspproto.FabricMSPConfig)
+		collectMSPs(members, msps)
+		if _, ok := msps[req.MSPID]; ok {
+			return nil, badRequest("msp %s is already a member of %s", req.MSPID, req.channelID)
+		}
+	}
+
+	// the bundle only replaces the stored one once the proposal is created
+	var bundleTmp, bundleDir string
+	if len(req.MSPBundle) > 0 {
+		tmp, sub, err := extractMSPBundle(req.MSPBundle)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		bundleTmp, bundleDir = tmp, req.MSPDir
+		req.MSPDir = filepath.Join(tmp, sub)
+	}
+	op.Orgs = []orgRequest{req.orgRequest}
+	tx, err := applyConfigOperations(req.channelID, config, []configOperation{op})
+	if err != nil {
+		return nil, err
+	}
+	if req.Description == "" {
+		req.Description = fmt.Sprintf("%s %s", op.Op, req.Name)
+	}
+	p, err = newConfigProposal(sdk, req.identityRequest, req.channelID, req.Description, config, tx, req.ttl, req.Orderer, true, req.dryRun)
+	if err != nil || req.dryRun || bundleDir == "" {
+		return p, err
+	}
+	if err := os.RemoveAll(bundleDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(bundleTmp, bundleDir); err != nil {
+		return nil, fmt.Errorf("error storing msp bundle of %s: %v", req.MSPID, err)
+	}
+	return p, nil
+}
+
+func doRemoveChannelOrg(profile sdkProfile, identity identityRequest, channelID, name, consortium, ttlValue, orderer string, dryRun bool) (p *configProposal, err error) {
+	if name == "" {
+		return nil, badRequest("name is required")
+	}
+	ttl, err := parseProposalTTL(ttlValue)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if orderer == "" {
+		orderer = ordererEndpoint
+	}
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+	if err != nil {
+		return nil, err
+	}
+	root := config.ChannelGroup
+	op := configOperation{Op: opDelApplicationOrgs, OrgNames: []string{name}}
+	if consortiums := root.Groups[consortiumsGroupKey]; consortiums != nil {
+		if op.Consortium, err = channelConsortium(consortiums.Groups, consortium); err != nil {
+			return nil, err
+		}
+		op.Op = opDelConsortiumOrgs
+	} else if consortium != "" {
+		return nil, badRequest("consortium is only used on the system channel")
+	} else if app := root.Groups[applicationGroupKey]; app != nil && len(app.Groups) == 1 && app.Groups[name] != nil {
+		return nil, badRequest("%s is the last application org of %s", name, channelID)
+	}
+	tx, err := applyConfigOperations(channelID, config, []configOperation{op})
+	if err != nil {
+		return nil, err
+	}
+	return newConfigProposal(sdk, identity, channelID, fmt.Sprintf("%s %s", op.Op, name), config, tx, ttl, orderer, true, dryRun)
+}
+
+// channelConsortium returns the named consortium, or the only one of the system channel if no name is given.
+func channelConsortium(consortiums map[string]*common.ConfigGroup, name string) (string, error) {
+	if name != "" {
+		if _, ok := consortiums[name]; !ok {
+			return "", badRequest("consortium %s is not found", name)
+		}
+		return name, nil
+	}
+	if len(consortiums) == 1 {
+		for name := range consortiums {
+			return name, nil
+		}
+	}
+	var names []string
+	for name := range consortiums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", badRequest("consortium is required, one of %s", strings.Join(names, ", "))
+}
+
+// extractMSPBundle unpacks the bundle into a new directory of the msp store and returns it with the
+// subdirectory holding the msp: "" or "msp". The caller removes the directory or renames it into place.
+func extractMSPBundle(bundle []byte) (string, string, error) {
+	if err := os.MkdirAll(mspStoreDir, 0755); err != nil {
+		return "", "", err
+	}
+	tmp, err := ioutil.TempDir(mspStoreDir, ".upload")
+	if err != nil {
+		return "", "", err
+	}
+	if err := extractTarGz(bundle, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", "", badRequest("invalid mspBundle: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "cacerts")); err == nil {
+		return tmp, "", nil
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "msp", "cacerts")); err == nil {
+		return tmp, "msp", nil
+	}
+	os.RemoveAll(tmp)
+	return "", "", badRequest("invalid mspBundle: no cacerts directory")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+)
+
+// collectionRequest is one private data collection, in the shape of the peer CLI's collections_config.json.
+// Collection queries answer in the same shape.
+type collectionRequest struct {
+	Name              string                        `json:"name"`
+	Policy            string                        `json:"policy"`
+	RequiredPeerCount int32                         `json:"requiredPeerCount"`
+	MaxPeerCount      int32                         `json:"maxPeerCount"`
+	BlockToLive       uint64                        `json:"blockToLive"`
+	MemberOnlyRead    bool                          `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool                          `json:"memberOnlyWrite"`
+	EndorsementPolicy *collectionEndorsementRequest `json:"endorsementPolicy,omitempty"`
+}
+
+type collectionEndorsementRequest struct {
+	SignaturePolicy     string `json:"signaturePolicy,omitempty"`
+	ChannelConfigPolicy string `json:"channelConfigPolicy,omitempty"`
+}
+
+func (r *collectionRequest) collectionConfig() (*pb.CollectionConfig, error) {
+	if r.Name == "" {
+		return nil, fmt.Errorf("collection name is required")
+	}
+	if r.Policy == "" {
+		return nil, fmt.Errorf("collection %s: policy is required", r.Name)
+	}
+	if r.RequiredPeerCount < 0 || r.MaxPeerCount < r.RequiredPeerCount {
+		return nil, fmt.Errorf("collection %s: requiredPeerCount %d must be between 0 and maxPeerCount %d", r.Name, r.RequiredPeerCount, r.MaxPeerCount)
+	}
+	memberOrgsPolicy, err := policydsl.FromString(r.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("collection %s: invalid policy: %v", r.Name, err)
+	}
+	cc := &pb.StaticCollectionConfig{
+		Name: r.Name,
+		MemberOrgsPolicy: &pb.CollectionPolicyConfig{
+			Payload: &pb.CollectionPolicyConfig_SignaturePolicy{SignaturePolicy: memberOrgsPolicy},
+		},
+		RequiredPeerCount: r.RequiredPeerCount,
+		MaximumPeerCount:  r.MaxPeerCount,
+		BlockToLive:       r.BlockToLive,
+		MemberOnlyRead:    r.MemberOnlyRead,
+		MemberOnlyWrite:   r.MemberOnlyWrite,
+	}
+	if ep := r.EndorsementPolicy; ep != nil {
+		switch {
+		case ep.SignaturePolicy != "" && ep.ChannelConfigPolicy != "":
+			return nil, fmt.Errorf("collection %s: endorsementPolicy takes either signaturePolicy or channelConfigPolicy", r.Name)
+		case ep.SignaturePolicy != "":
+			sp, err := policydsl.FromString(ep.SignaturePolicy)
+			if err != nil {
+				return nil, fmt.Errorf("collection %s: invalid endorsement signaturePolicy: %v", r.Name, err)
+			}
+			cc.EndorsementPolicy = &pb.ApplicationPolicy{Type: &pb.ApplicationPolicy_SignaturePolicy{SignaturePolicy: sp}}
+		case ep.ChannelConfigPolicy != "":
+			if err := validateChannelPolicyReference(ep.ChannelConfigPolicy); err != nil {
+				return nil, fmt.Errorf("collection %s: %v", r.Name, err)
+			}
+			cc.EndorsementPolicy = &pb.ApplicationPolicy{Type: &pb.ApplicationPolicy_ChannelConfigPolicyReference{ChannelConfigPolicyReference: ep.ChannelConfigPolicy}}
+		}
+	}
+	return &pb.CollectionConfig{Payload: &pb.CollectionConfig_StaticCollectionConfig{StaticCollectionConfig: cc}}, nil
+}
+
+func collectionConfigs(collections []collectionRequest) ([]*pb.CollectionConfig, error) {
+	seen := make(map[string]bool)
+	var configs []*pb.CollectionConfig
+	for i := range collections {
+		cc, err := collections[i].collectionConfig()
+		if err != nil {
+			return nil, err
+		}
+		if seen[collections[i].Name] {
+			return nil, fmt.Errorf("duplicate collection %s", collections[i].Name)
+		}
+		seen[collections[i].Name] = true
+		configs = append(configs, cc)
+	}
+	return configs, nil
+}
+
+// collectionFromConfig turns a collection config back into the collections_config.json shape.
+func collectionFromConfig(config *pb.CollectionConfig) (collectionRequest, bool) {
+	sc := config.GetStaticCollectionConfig()
+	if sc == nil {
+		return collectionRequest{}, false
+	}
+	c := collectionRequest{
+		Name:              sc.Name,
+		Policy:            signaturePolicyString(sc.GetMemberOrgsPolicy().GetSignaturePolicy()),
+		RequiredPeerCount: sc.RequiredPeerCount,
+		MaxPeerCount:      sc.MaximumPeerCount,
+		BlockToLive:       sc.BlockToLive,
+		MemberOnlyRead:    sc.MemberOnlyRead,
+		MemberOnlyWrite:   sc.MemberOnlyWrite,
+	}
+	if ep := sc.EndorsementPolicy; ep != nil {
+		c.EndorsementPolicy = &collectionEndorsementRequest{
+			SignaturePolicy:     signaturePolicyString(ep.GetSignaturePolicy()),
+			ChannelConfigPolicy: ep.GetChannelConfigPolicyReference(),
+		}
+	}
+	return c, true
+}
+
+func collectionsFromConfigs(configs []*pb.CollectionConfig) []collectionRequest {
+	collections := []collectionRequest{}
+	for _, config := range configs {
+		if c, ok := collectionFromConfig(config); ok {
+			collections = append(collections, c)
+		}
+	}
+	return collections
+}
+
+type queryCollectionsRequest struct {
+	identityRequest
+	ChannelID string   `json:"channelID"`
+	Name      string   `json:"name"`
+	Peers     []string `json:"peers,omitempty"`
+}
+
+func (r *queryCollectionsRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return nil
+}
+
+func queryCollections(w http.ResponseWriter, r *http.Request) {
+	var req queryCollectionsRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doQueryCollections(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doQueryCollections(profile sdkProfile, req *queryCollectionsRequest) (result []collectionRequest, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*pb.CollectionConfig
+	pkg, err := resMgmtClient.QueryCollectionsConfig(req.ChannelID, req.Name, targetOpts(req.Peers)...)
+	if err == nil {
+		configs = pkg.Config
+	} else {
+		// lscc only knows chaincodes deployed with the legacy lifecycle, fall back to the _lifecycle definition
+		log.Printf("lscc collections query for %s failed, trying _lifecycle: %v\n", req.Name, err)
+		committed, err := resMgmtClient.LifecycleQueryCommittedCC(req.ChannelID, resmgmt.LifecycleQueryCommittedCCRequest{Name: req.Name}, targetOpts(req.Peers)...)
+		if err != nil {
+			return nil, err
+		}
+		if len(committed) == 0 {
+			return nil, fmt.Errorf("chaincode %s is not found on channel %s", req.Name, req.ChannelID)
+		}
+		configs = committed[0].CollectionConfig
+	}
+	return collectionsFromConfigs(configs), nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// configChange is one config element that differs between two configs, rendered for review.
+type configChange struct {
+	// Path is prefixed with the element kind like in a ConfigUpdate, e.g. [Policy] /Channel/Application/Admins,
+	// single ACLs are listed as [ACL] /Channel/Application/ACLs/qscc/GetBlockByNumber
+	Path   string `json:"path"`
+	Action string `json:"action"` // added, removed or modified
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// configDiff lists what changes from current to updated, groups that are added or removed are
+// listed as a whole.
+func configDiff(current, updated *common.Config) []configChange {
+	changes := []configChange{}
+	diffGroup("/Channel", current.GetChannelGroup(), updated.GetChannelGroup(), &changes)
+	return changes
+}
+
+func diffGroup(path string, a, b *common.ConfigGroup, changes *[]configChange) {
+	switch {
+	case a == nil && b == nil:
+		return
+	case a == nil:
+		*changes = append(*changes, configChange{Path: "[Group] " + path, Action: "added", After: "mod_policy " + b.ModPolicy})
+		return
+	case b == nil:
+		*changes = append(*changes, configChange{Path: "[Group] " + path, Action: "removed", Before: "mod_policy " + a.ModPolicy})
+		return
+	}
+	if a.ModPolicy != b.ModPolicy {
+		*changes = append(*changes, configChange{Path: "[Group] " + path, Action: "modified", Before: "mod_policy " + a.ModPolicy, After: "mod_policy " + b.ModPolicy})
+	}
+	for _, name := range unionKeys(sortedKeys(a.Values), sortedKeys(b.Values)) {
+		va, vb := a.Values[name], b.Values[name]
+		if name == aclsKey && va != nil && vb != nil && va.ModPolicy == vb.ModPolicy {
+			diffACLs(path+"/"+name, va, vb, changes)
+			continue
+		}
+		var da, db []byte
+		var before, after string
+		if va != nil {
+			da, before = va.Value, renderValue(name, va)
+		}
+		if vb != nil {
+			db, after = vb.Value, renderValue(name, vb)
+		}
+		diffElement("[Value] "+path+"/"+name, va != nil, vb != nil, da, db, before, after, changes)
+	}
+	for _, name := range unionKeys(sortedKeys(a.Policies), sortedKeys(b.Policies)) {
+		pa, pn := a.Policies[name], b.Policies[name]
+		var da, db []byte
+		var before, after string
+		if pa != nil {
+			da, _ = proto.Marshal(pa.Policy)
+			before = renderPolicy(pa)
+		}
+		if pn != nil {
+			db, _ = proto.Marshal(pn.Policy)
+			after = renderPolicy(pn)
+		}
+		diffElement("[Policy] "+path+"/"+name, pa != nil, pn != nil, da, db, before, after, changes)
+	}
+	for _, name := range unionKeys(sortedKeys(a.Groups), sortedKeys(b.Groups)) {
+		diffGroup(path+"/"+name, a.Groups[name], b.Groups[name], changes)
+	}
+}
+
+func diffElement(path string, inA, inB bool, da, db []byte, before, after string, changes *[]configChange) {
+	switch {
+	case !inA:
+		*changes = append(*changes, configChange{Path: path, Action: "added", After: after})
+	case !inB:
+		*changes = append(*changes, configChange{Path: path, Action: "removed", Before: before})
+	case before != after || !bytes.Equal(da, db):
+		if before == after {
+			// the rendering leaves out what changed, e.g. a certificate
+			before = fmt.Sprintf("%s (sha256 %x)", before, sha256.Sum256(da))
+			after = fmt.Sprintf("%s (sha256 %x)", after, sha256.Sum256(db))
+		}
+		*changes = append(*changes, configChange{Path: path, Action: "modified", Before: before, After: after})
+	}
+}
+
+func diffACLs(path string, va, vb *common.ConfigValue, changes *[]configChange) {
+	a, b := &pb.ACLs{}, &pb.ACLs{}
+	if proto.Unmarshal(va.Value, a) != nil || proto.Unmarshal(vb.Value, b) != nil {
+		diffElement("[Value] "+path, true, true, va.Value, vb.Value, "<invalid ACLs>", "<invalid ACLs>", changes)
+		return
+	}
+	var ka, kb []string
+	for k := range a.Acls {
+		ka = append(ka, k)
+	}
+	for k := range b.Acls {
+		kb = append(kb, k)
+	}
+	sort.Strings(ka)
+	sort.Strings(kb)
+	for _, name := range unionKeys(ka, kb) {
+		ra, rb := a.Acls[name], b.Acls[name]
+		var before, after string
+		if ra != nil {
+			before = ra.PolicyRef
+		}
+		if rb != nil {
+			after = rb.PolicyRef
+		}
+		diffElement("[ACL] "+path+"/"+name, ra != nil, rb != nil, []byte(before), []byte(after), before, after, changes)
+	}
+}
+
+// unionKeys merges two sorted key lists.
+func unionKeys(a, b []string) []string {
+	keys := append([]string{}, a...)
+	for _, k := range b {
+		i := sort.SearchStrings(a, k)
+		if i == len(a) || a[i] != k {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func renderPolicy(p *common.ConfigPolicy) string {
+	typ, rule := policyRule(p.Policy)
+	return fmt.Sprintf("%s %s, mod_policy %s", typ, rule, p.ModPolicy)
+}
+
+// renderValue decodes the well known config values to a short text.
+func renderValue(name string, v *common.ConfigValue) string {
+	var s string
+	switch name {
+	case mspKey:
+		mc, conf := &mspproto.MSPConfig{}, &mspproto.FabricMSPConfig{}
+		if proto.Unmarshal(v.Value, mc) != nil || proto.Unmarshal(mc.Config, conf) != nil {
+			s = "<invalid msp>"
+			break
+		}
+		s = fmt.Sprintf("msp %s, %d root certs, %d intermediate certs, %d admins, %d CRLs, node OUs %v",
+			conf.Name, len(conf.RootCerts), len(conf.IntermediateCerts), len(conf.Admins), len(conf.RevocationList), conf.GetFabricNodeOus().GetEnable())
+	case consensusTypeKey:
+		ct := &orderer.ConsensusType{}
+		if proto.Unmarshal(v.Value, ct) != nil {
+			s = "<invalid consensus type>"
+			break
+		}
+		s = fmt.Sprintf("%s %s", ct.Type, ct.State)
+		md := &etcdraft.ConfigMetadata{}
+		if ct.Type == "etcdraft" && proto.Unmarshal(ct.Metadata, md) == nil {
+			var consenters []string
+			for _, c := range md.Consenters {
+				consenters = append(consenters, fmt.Sprintf("%s:%d", c.Host, c.Port))
+			}
+			s += ", consenters " + strings.Join(consenters, " ")
+		}
+	default:
+		var msg proto.Message
+		switch name {
+		case aclsKey:
+			msg = &pb.ACLs{}
+		case anchorPeersKey:
+			msg = &pb.AnchorPeers{}
+		case ordererAddressesKey, endpointsKey:
+			msg = &common.OrdererAddresses{}
+		case capabilitiesKey:
+			msg = &common.Capabilities{}
+		case batchSizeKey:
+			msg = &orderer.BatchSize{}
+		case batchTimeoutKey:
+			msg = &orderer.BatchTimeout{}
+		case consortiumKey:
+			msg = &common.Consortium{}
+		case "HashingAlgorithm":
+			msg = &common.HashingAlgorithm{}
+		case "BlockDataHashingStructure":
+			msg = &common.BlockDataHashingStructure{}
+		case "ChannelRestrictions":
+			msg = &orderer.ChannelRestrictions{}
+		}
+		if msg == nil || proto.Unmarshal(v.Value, msg) != nil {
+			s = fmt.Sprintf("%d bytes", len(v.Value))
+			break
+		}
+		s = strings.TrimSpace(proto.CompactTextString(msg))
+	}
+	return fmt.Sprintf("%s, mod_policy %s", s, v.ModPolicy)
+}
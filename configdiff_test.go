@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func testACLs(t *testing.T, acls map[string]string) *common.ConfigValue {
+	msg := &pb.ACLs{Acls: map[string]*pb.APIResource{}}
+	for name, ref := range acls {
+		msg.Acls[name] = &pb.APIResource{PolicyRef: ref}
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigValue{Value: b, ModPolicy: adminsPolicyKey}
+}
+
+func TestConfigDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(t *testing.T, g *common.ConfigGroup)
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			update: func(t *testing.T, g *common.ConfigGroup) {},
+			want:   nil,
+		},
+		{
+			name: "value added, modified and removed",
+			update: func(t *testing.T, g *common.ConfigGroup) {
+				g.Values["A"] = testValue(1, "a2")
+				delete(g.Values, "B")
+				g.Values["C"] = testValue(0, "c")
+			},
+			want: []string{"[Value] /Channel/A modified", "[Value] /Channel/B removed", "[Value] /Channel/C added"},
+		},
+		{
+			name: "policy added and removed",
+			update: func(t *testing.T, g *common.ConfigGroup) {
+				delete(g.Policies, "Admins")
+				g.Groups["Application"].Policies = map[string]*common.ConfigPolicy{"Readers": testPolicy(0)}
+			},
+			want: []string{"[Policy] /Channel/Admins removed", "[Policy] /Channel/Application/Readers added"},
+		},
+		{
+			name: "policy modified",
+			update: func(t *testing.T, g *common.ConfigGroup) {
+				g.Policies["Admins"].ModPolicy = "Writers"
+			},
+			want: []string{"[Policy] /Channel/Admins modified"},
+		},
+		{
+			name: "groups added and removed as a whole",
+			update: func(t *testing.T, g *common.ConfigGroup) {
+				orgs := g.Groups["Application"].Groups
+				delete(orgs, "Org2")
+				orgs["Org3"] = testGroup(0, map[string]*common.ConfigValue{"MSP": testValue(0, "org3")}, nil, nil)
+			},
+			want: []string{"[Group] /Channel/Application/Org2 removed", "[Group] /Channel/Application/Org3 added"},
+		},
+		{
+			name: "group mod_policy modified",
+			update: func(t *testing.T, g *common.ConfigGroup) {
+				g.Groups["Application"].ModPolicy = "Writers"
+			},
+			want: []string{"[Group] /Channel/Application modified"},
+		},
+		{
+			name: "version only is not a change",
+			update: func(t *testing.T, g *common.ConfigGroup) {
+				g.Version = 3
+				g.Values["A"].Version = 3
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := testCurrentConfig()
+			tt.update(t, updated)
+			var got []string
+			for _, c := range configDiff(&common.Config{ChannelGroup: testCurrentConfig()}, &common.Config{ChannelGroup: updated}) {
+				got = append(got, c.Path+" "+c.Action)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configDiff() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigDiffRendering(t *testing.T) {
+	current, updated := testCurrentConfig(), testCurrentConfig()
+	updated.Values["A"] = testValue(1, "z")
+	updated.Policies["Admins"].ModPolicy = "Writers"
+
+	changes := configDiff(&common.Config{ChannelGroup: current}, &common.Config{ChannelGroup: updated})
+	if len(changes) != 2 {
+		t.Fatalf("configDiff() = %d changes, want 2", len(changes))
+	}
+	// the value renders the same before and after, the hashes tell them apart
+	if v := changes[0]; !strings.Contains(v.Before, "sha256") || v.Before == v.After {
+		t.Errorf("value change %q -> %q, want differing hashes", v.Before, v.After)
+	}
+	if p := changes[1]; !strings.HasSuffix(p.Before, "mod_policy Admins") || !strings.HasSuffix(p.After, "mod_policy Writers") {
+		t.Errorf("policy change %q -> %q, want the mod_policy", p.Before, p.After)
+	}
+}
+
+func TestConfigDiffACLs(t *testing.T) {
+	current, updated := testCurrentConfig(), testCurrentConfig()
+	current.Groups["Application"].Values[aclsKey] = testACLs(t, map[string]string{
+		"qscc/GetChainInfo":   "/Channel/Application/Readers",
+		"cscc/GetConfigBlock": "/Channel/Application/Readers",
+	})
+	updated.Groups["Application"].Values[aclsKey] = testACLs(t, map[string]string{
+		"qscc/GetChainInfo":      "/Channel/Application/Writers",
+		"lscc/GetDeploymentSpec": "/Channel/Application/Readers",
+	})
+
+	want := []configChange{
+		{Path: "[ACL] /Channel/Application/ACLs/cscc/GetConfigBlock", Action: "removed", Before: "/Channel/Application/Readers"},
+		{Path: "[ACL] /Channel/Application/ACLs/lscc/GetDeploymentSpec", Action: "added", After: "/Channel/Application/Readers"},
+		{Path: "[ACL] /Channel/Application/ACLs/qscc/GetChainInfo", Action: "modified", Before: "/Channel/Application/Readers", After: "/Channel/Application/Writers"},
+	}
+	if got := configDiff(&common.Config{ChannelGroup: current}, &common.Config{ChannelGroup: updated}); !reflect.DeepEqual(got, want) {
+		t.Errorf("configDiff() =\n%+v\nwant\n%+v", got, want)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource/genesisconfig"
+	"gopkg.in/yaml.v3"
+)
+
+const configtxFilePath = "./configtx.yaml"
+
+// configtxTopLevel is the part of configtx.yaml the gateway uses. Sections that are only referenced
+// through anchors, like Organizations or Capabilities, are already merged into the profiles.
+type configtxTopLevel struct {
+	Profiles map[string]*configtxProfile `yaml:"Profiles"`
+}
+
+// configtxProfile is genesisconfig.Profile as written in configtx.yaml, where the orderer section
+// uses byte sizes such as "99 MB" and file paths for certificates.
+type configtxProfile struct {
+	Consortium   string                               `yaml:"Consortium"`
+	Application  *genesisconfig.Application           `yaml:"Application"`
+	Orderer      *configtxOrderer                     `yaml:"Orderer"`
+	Consortiums  map[string]*genesisconfig.Consortium `yaml:"Consortiums"`
+	Capabilities map[string]bool                      `yaml:"Capabilities"`
+	Policies     map[string]*genesisconfig.Policy     `yaml:"Policies"`
+}
+
+type configtxOrderer struct {
+	OrdererType  string        `yaml:"OrdererType"`
+	Addresses    []string      `yaml:"Addresses"`
+	BatchTimeout time.Duration `yaml:"BatchTimeout"`
+	BatchSize    struct {
+		MaxMessageCount   uint32   `yaml:"MaxMessageCount"`
+		AbsoluteMaxBytes  byteSize `yaml:"AbsoluteMaxBytes"`
+		PreferredMaxBytes byteSize `yaml:"PreferredMaxBytes"`
+	} `yaml:"BatchSize"`
+	Kafka         genesisconfig.Kafka               `yaml:"Kafka"`
+	EtcdRaft      *configtxEtcdRaft                 `yaml:"EtcdRaft"`
+	PBFT          *genesisconfig.YbftConfigMetadata `yaml:"PBFT"`
+	Organizations []*genesisconfig.Organization     `yaml:"Organizations"`
+	MaxChannels   uint64                            `yaml:"MaxChannels"`
+	Capabilities  map[string]bool                   `yaml:"Capabilities"`
+	Policies      map[string]*genesisconfig.Policy  `yaml:"Policies"`
+}
+
+type configtxEtcdRaft struct {
+	Consenters []struct {
+		Host          string `yaml:"Host"`
+		Port          uint32 `yaml:"Port"`
+		ClientTLSCert string `yaml:"ClientTLSCert"`
+		ServerTLSCert string `yaml:"ServerTLSCert"`
+	} `yaml:"Consenters"`
+	Options struct {
+		TickInterval         string   `yaml:"TickInterval"`
+		ElectionTick         uint32   `yaml:"ElectionTick"`
+		HeartbeatTick        uint32   `yaml:"HeartbeatTick"`
+		MaxInflightBlocks    uint32   `yaml:"MaxInflightBlocks"`
+		SnapshotIntervalSize byteSize `yaml:"SnapshotIntervalSize"`
+	} `yaml:"Options"`
+}
+
+// byteSize is a size like configtxgen accepts it: a plain number of bytes or a number with a KB, MB or GB unit.
+type byteSize uint32
+
+var byteSizePattern = regexp.MustCompile(`^([0-9]+)\s*([KMG]B)?$`)
+
+func (s *byteSize) UnmarshalYAML(value *yaml.Node) error {
+	m := byteSizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(value.Value)))
+	if m == nil {
+		return fmt.Errorf("line %d: invalid byte size %q", value.Line, value.Value)
+	}
+	n, err := strconv.ParseUint(m[1], 10, 32)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid byte size %q: %v", value.Line, value.Value, err)
+	}
+	switch m[2] {
+	case "KB":
+		n <<= 10
+	case "MB":
+		n <<= 20
+	case "GB":
+		n <<= 30
+	}
+	if n > 1<<32-1 {
+		return fmt.Errorf("line %d: byte size %q is too large", value.Line, value.Value)
+	}
+	*s = byteSize(n)
+	return nil
+}
+
+// loadConfigtx parses a configtx.yaml. Relative MSPDir and certificate paths are resolved against
+// the directory of the file, as configtxgen does.
+func loadConfigtx(path string) (*configtxTopLevel, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading configtx: %v", err)
+	}
+	var top configtxTopLevel
+	if err := yaml.Unmarshal(data, &top); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range top.Profiles {
+		if p != nil {
+			p.resolvePaths(dir)
+		}
+	}
+	return &top, nil
+}
+
+// profile returns the named profile in the shape the resource package builds artifacts from.
+func (t *configtxTopLevel) profile(name string) (*genesisconfig.Profile, error) {
+	p, ok := t.Profiles[name]
+	if !ok || p == nil {
+		names := make([]string, 0, len(t.Profiles))
+		for n := range t.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, badRequest("profile %s is not found in configtx, available: %s", name, strings.Join(names, ", "))
+	}
+	gp := &genesisconfig.Profile{
+		Consortium:   p.Consortium,
+		Application:  p.Application,
+		Consortiums:  p.Consortiums,
+		Capabilities: p.Capabilities,
+		Policies:     p.Policies,
+	}
+	if p.Orderer != nil {
+		o, err := p.Orderer.orderer()
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %v", name, err)
+		}
+		gp.Orderer = o
+	}
+	return gp, nil
+}
+
+func (o *configtxOrderer) orderer() (*genesisconfig.Orderer, error) {
+	batch := batchRequest{
+		MaxMessageCount:   o.BatchSize.MaxMessageCount,
+		AbsoluteMaxBytes:  uint32(o.BatchSize.AbsoluteMaxBytes),
+		PreferredMaxBytes: uint32(o.BatchSize.PreferredMaxBytes),
+	}
+	if o.BatchTimeout > 0 {
+		batch.Timeout = o.BatchTimeout.String()
+	}
+	if err := batch.validate(); err != nil {
+		return nil, err
+	}
+	orderer := &genesisconfig.Orderer{
+		OrdererType:  o.OrdererType,
+		Addresses:    o.Addresses,
+		BatchTimeout: batch.timeout,
+		BatchSize: genesisconfig.BatchSize{
+			MaxMessageCount:   batch.MaxMessageCount,
+			AbsoluteMaxBytes:  batch.AbsoluteMaxBytes,
+			PreferredMaxBytes: batch.PreferredMaxBytes,
+		},
+		Kafka:         o.Kafka,
+		Organizations: o.Organizations,
+		MaxChannels:   o.MaxChannels,
+		Capabilities:  o.Capabilities,
+		Policies:      o.Policies,
+	}
+	switch o.OrdererType {
+	case genesisconfig.ConsensusTypeEtcdRaft:
+		if o.EtcdRaft == nil {
+			return nil, fmt.Errorf("orderer EtcdRaft section is required for OrdererType %s", o.OrdererType)
+		}
+		raft := &etcdRaftRequest{Options: &raftOptionsRequest{
+			TickInterval:         o.EtcdRaft.Options.TickInterval,
+			ElectionTick:         o.EtcdRaft.Options.ElectionTick,
+			HeartbeatTick:        o.EtcdRaft.Options.HeartbeatTick,
+			MaxInflightBlocks:    o.EtcdRaft.Options.MaxInflightBlocks,
+			SnapshotIntervalSize: uint32(o.EtcdRaft.Options.SnapshotIntervalSize),
+		}}
+		for _, c := range o.EtcdRaft.Consenters {
+			raft.Consenters = append(raft.Consenters, raftConsenterRequest{
+				Host:          c.Host,
+				Port:          c.Port,
+				ClientTLSCert: c.ClientTLSCert,
+				ServerTLSCert: c.ServerTLSCert,
+			})
+		}
+		if err := raft.validate(); err != nil {
+			return nil, err
+		}
+		orderer.EtcdRaft = raft.configMetadata()
+	case genesisconfig.ConsensusTypePBFT:
+		if o.PBFT == nil {
+			return nil, fmt.Errorf("orderer PBFT section is required for OrdererType %s", o.OrdererType)
+		}
+		pbft := &pbftRequest{}
+		if opts := o.PBFT.Options; opts != nil {
+			pbft.Options = &pbftOptionsRequest{
+				ProposeTimeout:        opts.ProposeTimeout,
+				ProposeDeltaTimeout:   opts.ProposeDeltaTimeout,
+				PrevoteTimeout:        opts.PrevoteTimeout,
+				PrevoteDeltaTimeout:   opts.PrevoteDeltaTimeout,
+				PrecommitTimeout:      opts.PrecommitTimeout,
+				PrecommitDeltaTimeout: opts.PrecommitDeltaTimeout,
+				ProposeBlocks:         opts.ProposeBlocks,
+			}
+		}
+		for _, c := range o.PBFT.Consenters {
+			pbft.Consenters = append(pbft.Consenters, pbftConsenterRequest{
+				Host:          c.Host,
+				Port:          c.Port,
+				ClientTLSCert: c.ClientTlsCert,
+				ServerTLSCert: c.ServerTlsCert,
+				MSPID:         c.MspId,
+				MSPCert:       c.MspCert,
+			})
+		}
+		ordererMSPs := make(map[string]bool)
+		for _, org := range o.Organizations {
+			ordererMSPs[org.ID] = true
+		}
+		if err := pbft.validate(ordererMSPs); err != nil {
+			return nil, err
+		}
+		orderer.PBFT = pbft.configMetadata()
+	}
+	return orderer, nil
+}
+
+func (p *configtxProfile) resolvePaths(dir string) {
+	var orgs []*genesisconfig.Organization
+	if p.Application != nil {
+		orgs = append(orgs, p.Application.Organizations...)
+	}
+	for _, c := range p.Consortiums {
+		if c != nil {
+			orgs = append(orgs, c.Organizations...)
+		}
+	}
+	if o := p.Orderer; o != nil {
+		orgs = append(orgs, o.Organizations...)
+		if o.EtcdRaft != nil {
+			for i := range o.EtcdRaft.Consenters {
+				c := &o.EtcdRaft.Consenters[i]
+				c.ClientTLSCert = resolvePath(dir, c.ClientTLSCert)
+				c.ServerTLSCert = resolvePath(dir, c.ServerTLSCert)
+			}
+		}
+		if o.PBFT != nil {
+			for _, c := range o.PBFT.Consenters {
+				c.ClientTlsCert = resolvePath(dir, c.ClientTlsCert)
+				c.ServerTlsCert = resolvePath(dir, c.ServerTlsCert)
+				c.MspCert = resolvePath(dir, c.MspCert)
+			}
+		}
+	}
+	for _, org := range orgs {
+		if org == nil {
+			continue
+		}
+		org.MSPDir = resolvePath(dir, org.MSPDir)
+		if org.MSPType == "" {
+			org.MSPType = genesisconfig.DefaultMSPType
+		}
+	}
+}
+
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// loadConfigtxProfile loads the named profile from the configtx.yaml at path, or the one shipped
+// with the gateway.
+func loadConfigtxProfile(path, name string) (*genesisconfig.Profile, error) {
+	if path == "" {
+		path = configtxFilePath
+	}
+	top, err := loadConfigtx(path)
+	if err != nil {
+		return nil, err
+	}
+	return top.profile(name)
+}
@@ -0,0 +1,965 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	gmx509 "github.com/Hyperledger-TWGC/ccs-gm/x509"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource/genesisconfig"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+)
+
+// how often commitConfigUpdate looks for the new config block
+const configCommitPollInterval = time.Second
+
+// config update operations, each one maps to a genesisconfig.ConfOption
+const (
+	opAddOrdererAddresses     = "addOrdererAddresses"
+	opDelOrdererAddresses     = "delOrdererAddresses"
+	opAddOrUpdateRaftNodes    = "addOrUpdateRaftNodes"
+	opDelRaftNodes            = "delRaftNodes"
+	opAddApplicationOrgs      = "addApplicationOrgs"
+	opUpdateApplicationOrgs   = "updateApplicationOrgs"
+	opDelApplicationOrgs      = "delApplicationOrgs"
+	opAddOrdererOrgs          = "addOrdererOrgs"
+	opUpdateOrdererOrgs       = "updateOrdererOrgs"
+	opDelOrdererOrgs          = "delOrdererOrgs"
+	opAddConsortiumOrgs       = "addConsortiumOrgs"
+	opUpdateConsortiumOrgs    = "updateConsortiumOrgs"
+	opDelConsortiumOrgs       = "delConsortiumOrgs"
+	opUpdateAnchorPeers       = "updateAnchorPeers"
+	opSetAnchorPeers          = "setAnchorPeers"
+	opUpdateApplicationPolicy = "updateApplicationPolicy"
+	opSetPolicy               = "setPolicy"
+	opSetACLs                 = "setACLs"
+	opSetCapability           = "setCapability"
+	opSetBatchSize            = "setBatchSize"
+	opSetRevocationList       = "setRevocationList"
+)
+
+// configOperation is one typed change of a channel config. Which fields are used depends on Op.
+type configOperation struct {
+	Op string `json:"op"`
+	// add/delOrdererAddresses, host:port
+	Addresses []string `json:"addresses,omitempty"`
+	// addOrUpdateRaftNodes, certificates are paths to PEM files; delRaftNodes only needs host and port
+	Consenters []raftConsenterRequest `json:"consenters,omitempty"`
+	// add/update orgs of the application, orderer or a consortium
+	Orgs []orgRequest `json:"orgs,omitempty"`
+	// del orgs, by config group name
+	OrgNames   []string `json:"orgNames,omitempty"`
+	Consortium string   `json:"consortium,omitempty"`
+	// updateAnchorPeers adds anchor peers to the application org Org, setAnchorPeers replaces them
+	Org         string              `json:"org,omitempty"`
+	AnchorPeers []anchorPeerRequest `json:"anchorPeers,omitempty"`
+	// updateApplicationPolicy, and setPolicy which adds or replaces the policy in the group at Path,
+	// e.g. /Channel/Application/Org1MSP
+	Policy *applicationPolicyRequest `json:"policy,omitempty"`
+	Path   string                    `json:"path,omitempty"`
+	// setACLs maps API resources such as qscc/GetBlockByNumber to policy paths, an empty path removes the ACL
+	ACLs map[string]string `json:"acls,omitempty"`
+	// setCapability replaces the capabilities of the group at Path, /Channel, /Channel/Orderer or
+	// /Channel/Application, with Capability, e.g. V2_0
+	Capability string `json:"capability,omitempty"`
+	// setBatchSize changes the block cutting of the orderer, fields left out keep their current value
+	Batch *batchRequest `json:"batch,omitempty"`
+	// setRevocationList replaces the CRLs of the MSP of the org group at Path with the PEM files in
+	// CRLs, none clears them
+	CRLs []string `json:"crls,omitempty"`
+}
+
+type applicationPolicyRequest struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // ImplicitMeta or Signature
+	Rule string `json:"rule"` // e.g. MAJORITY Admins, or OR('Org1MSP.admin')
+}
+
+var implicitMetaRules = map[string]int32{"ANY": 0, "ALL": 1, "MAJORITY": 2}
+
+func (p *applicationPolicyRequest) strategy() (genesisconfig.StrategyPolicy, error) {
+	if p.Name == "" {
+		return genesisconfig.StrategyPolicy{}, fmt.Errorf("policy name is required")
+	}
+	switch p.Type {
+	case "ImplicitMeta":
+		fields := strings.Fields(p.Rule)
+		if len(fields) != 2 {
+			return genesisconfig.StrategyPolicy{}, fmt.Errorf("invalid ImplicitMeta rule %q, expected e.g. MAJORITY Admins", p.Rule)
+		}
+		rule, ok := implicitMetaRules[strings.ToUpper(fields[0])]
+		if !ok {
+			return genesisconfig.StrategyPolicy{}, fmt.Errorf("invalid ImplicitMeta rule %q, expected e.g. MAJORITY Admins", p.Rule)
+		}
+		return genesisconfig.StrategyPolicy{Name: p.Name, Type: rule, ImplicitMetaSubPolicy: fields[1]}, nil
+	case "Signature":
+		// the sdk ignores rules it cannot parse, check first
+		if _, err := policydsl.FromString(p.Rule); err != nil {
+			return genesisconfig.StrategyPolicy{}, fmt.Errorf("invalid Signature rule %q: %v", p.Rule, err)
+		}
+		return genesisconfig.StrategyPolicy{Name: p.Name, Type: 3, Policy: p.Rule}, nil
+	}
+	return genesisconfig.StrategyPolicy{}, fmt.Errorf("policy type must be ImplicitMeta or Signature")
+}
+
+// configPolicy builds the policy as configtxgen does for configtx.yaml policies.
+func (p *applicationPolicyRequest) configPolicy() (*common.Policy, error) {
+	if p.Name == "" {
+		return nil, fmt.Errorf("policy name is required")
+	}
+	if err := (orgPolicyRequest{Type: p.Type, Rule: p.Rule}).validate(); err != nil {
+		return nil, err
+	}
+	var typ common.Policy_PolicyType
+	var msg proto.Message
+	if p.Type == "Signature" {
+		typ = common.Policy_SIGNATURE
+		msg, _ = policydsl.FromString(p.Rule)
+	} else {
+		fields := strings.Fields(p.Rule)
+		typ = common.Policy_IMPLICIT_META
+		msg = &common.ImplicitMetaPolicy{
+			Rule:      common.ImplicitMetaPolicy_Rule(implicitMetaRules[strings.ToUpper(fields[0])]),
+			SubPolicy: fields[1],
+		}
+	}
+	value, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &common.Policy{Type: int32(typ), Value: value}, nil
+}
+
+// channelACLs returns the ACLs of an application channel config, resource to policy reference.
+func channelACLs(config *common.Config) (map[string]string, error) {
+	acls := make(map[string]string)
+	v, ok := config.GetChannelGroup().GetGroups()[applicationGroupKey].GetValues()[aclsKey]
+	if !ok {
+		return acls, nil
+	}
+	m := &pb.ACLs{}
+	if err := proto.Unmarshal(v.Value, m); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", aclsKey, err)
+	}
+	for resource, r := range m.Acls {
+		acls[resource] = r.PolicyRef
+	}
+	return acls, nil
+}
+
+func (o *configOperation) validate() error {
+	switch o.Op {
+	case opAddOrdererAddresses, opDelOrdererAddresses:
+		if len(o.Addresses) == 0 {
+			return fmt.Errorf("%s: addresses is required", o.Op)
+		}
+		for _, addr := range o.Addresses {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return fmt.Errorf("%s: invalid address %q", o.Op, addr)
+			}
+		}
+	case opAddOrUpdateRaftNodes:
+		raft := etcdRaftRequest{Consenters: o.Consenters}
+		if err := raft.validate(); err != nil {
+			return fmt.Errorf("%s: %v", o.Op, err)
+		}
+	case opDelRaftNodes:
+		if len(o.Consenters) == 0 {
+			return fmt.Errorf("%s: consenters is required", o.Op)
+		}
+		for _, c := range o.Consenters {
+			if c.Host == "" || c.Port == 0 || c.Port > 65535 {
+				return fmt.Errorf("%s: invalid consenter %s:%d", o.Op, c.Host, c.Port)
+			}
+		}
+	case opAddApplicationOrgs, opUpdateApplicationOrgs, opAddOrdererOrgs, opUpdateOrdererOrgs:
+		if err := validateOrgs(o.Op+" orgs", o.Orgs); err != nil {
+			return err
+		}
+	case opAddConsortiumOrgs, opUpdateConsortiumOrgs:
+		if o.Consortium == "" {
+			return fmt.Errorf("%s: consortium is required", o.Op)
+		}
+		if err := validateOrgs(o.Op+" orgs", o.Orgs); err != nil {
+			return err
+		}
+	case opDelConsortiumOrgs:
+		if o.Consortium == "" {
+			return fmt.Errorf("%s: consortium is required", o.Op)
+		}
+		if len(o.OrgNames) == 0 {
+			return fmt.Errorf("%s: orgNames is required", o.Op)
+		}
+	case opDelApplicationOrgs, opDelOrdererOrgs:
+		if len(o.OrgNames) == 0 {
+			return fmt.Errorf("%s: orgNames is required", o.Op)
+		}
+	case opUpdateAnchorPeers:
+		if o.Org == "" || len(o.AnchorPeers) == 0 {
+			return fmt.Errorf("%s: org and anchorPeers are required", o.Op)
+		}
+		for _, ap := range o.AnchorPeers {
+			if err := ap.validate(); err != nil {
+				return fmt.Errorf("%s: %v", o.Op, err)
+			}
+		}
+	case opSetAnchorPeers:
+		if o.Org == "" {
+			return fmt.Errorf("%s: org is required", o.Op)
+		}
+		for _, ap := range o.AnchorPeers {
+			if err := ap.validate(); err != nil {
+				return fmt.Errorf("%s: %v", o.Op, err)
+			}
+		}
+	case opUpdateApplicationPolicy:
+		if o.Policy == nil {
+			return fmt.Errorf("%s: policy is required", o.Op)
+		}
+		if _, err := o.Policy.strategy(); err != nil {
+			return fmt.Errorf("%s: %v", o.Op, err)
+		}
+	case opSetPolicy:
+		if o.Policy == nil {
+			return fmt.Errorf("%s: policy is required", o.Op)
+		}
+		if !strings.HasPrefix(o.Path, "/Channel") {
+			return fmt.Errorf("%s: invalid path %q", o.Op, o.Path)
+		}
+		if _, err := o.Policy.configPolicy(); err != nil {
+			return fmt.Errorf("%s: %v", o.Op, err)
+		}
+	case opSetACLs:
+		if len(o.ACLs) == 0 {
+			return fmt.Errorf("%s: acls is required", o.Op)
+		}
+		for resource := range o.ACLs {
+			if !strings.Contains(resource, "/") {
+				return fmt.Errorf("%s: invalid resource %q, expected e.g. qscc/GetBlockByNumber", o.Op, resource)
+			}
+		}
+	case opSetCapability:
+		if err := checkCapability(o.Path, o.Capability); err != nil {
+			return fmt.Errorf("%s: %v", o.Op, err)
+		}
+	case opSetBatchSize:
+		if o.Batch == nil || *o.Batch == (batchRequest{}) {
+			return fmt.Errorf("%s: batch is required", o.Op)
+		}
+		timeout, err := parseTimeout("batch timeout", o.Batch.Timeout)
+		if err != nil {
+			return fmt.Errorf("%s: %v", o.Op, err)
+		}
+		o.Batch.timeout = timeout
+	case opSetRevocationList:
+		if !strings.HasPrefix(o.Path, "/Channel/") {
+			return fmt.Errorf("%s: invalid path %q", o.Op, o.Path)
+		}
+	default:
+		return fmt.Errorf("unknown config operation %q", o.Op)
+	}
+	return nil
+}
+
+// confOption checks the operation against the current config, the sdk options assume the groups
+// they touch exist, and returns the option.
+func (o *configOperation) confOption(config *common.Config) (genesisconfig.ConfOption, error) {
+	root := config.GetChannelGroup()
+	switch o.Op {
+	case opAddOrdererAddresses:
+		return genesisconfig.AddOrdererAddrs(o.Addresses), nil
+	case opDelOrdererAddresses:
+		return genesisconfig.DelOrdererAddrs(o.Addresses), nil
+	case opAddOrUpdateRaftNodes:
+		var consenters []etcdraft.Consenter
+		for _, c := range o.Consenters {
+			consenter, err := c.consenter()
+			if err != nil {
+				return nil, err
+			}
+			consenters = append(consenters, consenter)
+		}
+		add := genesisconfig.AddOrUpdateRaftNodes(consenters)
+		// AddOrUpdateRaftNodes keeps the certificates of consenters that are already there, replace them first
+		return func(config *common.Config) error {
+			if err := updateConsenterCerts(config, consenters); err != nil {
+				return err
+			}
+			return add(config)
+		}, nil
+	case opDelRaftNodes:
+		current, err := genesisconfig.ExtractRaftNodesFromConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		var consenters []etcdraft.Consenter
+		for _, c := range o.Consenters {
+			found := false
+			for _, cur := range current {
+				found = found || (cur.Host == c.Host && cur.Port == c.Port)
+			}
+			if !found {
+				return nil, badRequest("%s: %s:%d is not a consenter of the channel", o.Op, c.Host, c.Port)
+			}
+			consenters = append(consenters, etcdraft.Consenter{Host: c.Host, Port: c.Port})
+		}
+		return genesisconfig.DelRaftNodes(consenters), nil
+	case opAddApplicationOrgs, opUpdateApplicationOrgs, opDelApplicationOrgs:
+		group := root.GetGroups()[applicationGroupKey]
+		if group == nil {
+			return nil, badRequest("%s: the channel has no application group", o.Op)
+		}
+		if err := o.checkOrgs(group, "application"); err != nil {
+			return nil, err
+		}
+		var orgs []*genesisconfig.Organization
+		for _, org := range o.Orgs {
+			orgs = append(orgs, org.channelOrg())
+		}
+		switch o.Op {
+		case opAddApplicationOrgs:
+			return genesisconfig.AddGroupApplicationOrgs(orgs), nil
+		case opUpdateApplicationOrgs:
+			return genesisconfig.UpdateGroupApplicationOrgs(orgs), nil
+		}
+		return genesisconfig.DelGroupApplicationOrgs(o.OrgNames), nil
+	case opAddOrdererOrgs, opUpdateOrdererOrgs, opDelOrdererOrgs:
+		if err := o.checkOrgs(root.GetGroups()[ordererGroupKey], "orderer"); err != nil {
+			return nil, err
+		}
+		var orgs []*genesisconfig.Organization
+		for _, org := range o.Orgs {
+			gorg := org.genesisOrg()
+			gorg.Policies = org.policies(genesisconfig.GetSignaturePolicyDefaults(org.MSPID))
+			orgs = append(orgs, gorg)
+		}
+		switch o.Op {
+		case opAddOrdererOrgs:
+			return genesisconfig.AddGroupOrdererOrg(orgs), nil
+		case opUpdateOrdererOrgs:
+			return genesisconfig.UpdateGroupOrdererOrg(orgs), nil
+		}
+		return genesisconfig.DelGroupOrdererOrg(o.OrgNames), nil
+	case opAddConsortiumOrgs, opUpdateConsortiumOrgs:
+		consortiums := root.GetGroups()[consortiumsGroupKey]
+		if consortiums == nil {
+			return nil, badRequest("%s: only the system channel has consortiums", o.Op)
+		}
+		if c := consortiums.Groups[o.Consortium]; c != nil {
+			if err := o.checkOrgs(c, "consortium "+o.Consortium); err != nil {
+				return nil, err
+			}
+		} else if o.Op == opUpdateConsortiumOrgs {
+			return nil, badRequest("%s: consortium %s is not found", o.Op, o.Consortium)
+		}
+		var orgs []*genesisconfig.Organization
+		for _, org := range o.Orgs {
+			gorg := org.genesisOrg()
+			gorg.Policies = org.policies(genesisconfig.GetSignaturePolicyDefaults(org.MSPID))
+			orgs = append(orgs, gorg)
+		}
+		if o.Op == opAddConsortiumOrgs {
+			return genesisconfig.AddGroupConsortiumOrgs(map[string][]*genesisconfig.Organization{o.Consortium: orgs}), nil
+		}
+		return genesisconfig.UpdateGroupConsortiumOrgs(map[string][]*genesisconfig.Organization{o.Consortium: orgs}), nil
+	case opDelConsortiumOrgs:
+		consortiums := root.GetGroups()[consortiumsGroupKey]
+		if consortiums == nil {
+			return nil, badRequest("%s: only the system channel has consortiums", o.Op)
+		}
+		// the sdk only removes from SampleConsortium, and every org whose name contains the given one
+		if o.Consortium != defaultConsortium {
+			return nil, badRequest("%s: orgs can only be removed from %s", o.Op, defaultConsortium)
+		}
+		c := consortiums.Groups[o.Consortium]
+		if err := o.checkOrgs(c, "consortium "+o.Consortium); err != nil {
+			return nil, err
+		}
+		var opts []genesisconfig.ConfOption
+		for _, name := range o.OrgNames {
+			for key := range c.Groups {
+				if key != name && strings.Contains(key, name) {
+					return nil, badRequest("%s: removing %s would also remove %s", o.Op, name, key)
+				}
+			}
+			opts = append(opts, genesisconfig.DelConsortiumOrgsByOrgName(name))
+		}
+		return func(config *common.Config) error {
+			for _, opt := range opts {
+				if err := opt(config); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil
+	case opUpdateAnchorPeers, opSetAnchorPeers:
+		app := root.GetGroups()[applicationGroupKey]
+		if app == nil || app.Groups[o.Org] == nil {
+			return nil, badRequest("%s: %s is not an application org of the channel", o.Op, o.Org)
+		}
+		var aps []*genesisconfig.AnchorPeer
+		for _, ap := range o.AnchorPeers {
+			aps = append(aps, &genesisconfig.AnchorPeer{Host: ap.Host, Port: ap.Port})
+		}
+		if o.Op == opUpdateAnchorPeers {
+			return genesisconfig.UpdateAnchorPeers(o.Org, aps), nil
+		}
+		// UpdateAnchorPeers keeps the current anchor peers, drop them first
+		return func(config *common.Config) error {
+			org := config.ChannelGroup.Groups[applicationGroupKey].Groups[o.Org]
+			delete(org.Values, anchorPeersKey)
+			if len(aps) == 0 {
+				return nil
+			}
+			return genesisconfig.UpdateAnchorPeers(o.Org, aps)(config)
+		}, nil
+	case opUpdateApplicationPolicy:
+		app := root.GetGroups()[applicationGroupKey]
+		if app == nil || app.Policies[o.Policy.Name] == nil {
+			return nil, badRequest("%s: the application has no policy %s", o.Op, o.Policy.Name)
+		}
+		policy, _ := o.Policy.strategy()
+		return genesisconfig.UpdateGroupApplicationStrategy(policy), nil
+	case opSetPolicy:
+		group := lookupConfigGroup(root, o.Path)
+		if group == nil {
+			return nil, badRequest("%s: group %s is not found", o.Op, o.Path)
+		}
+		if o.Policy.Type == "ImplicitMeta" && len(group.Groups) == 0 {
+			return nil, badRequest("%s: %s has no sub groups for an ImplicitMeta policy", o.Op, o.Path)
+		}
+		policy, _ := o.Policy.configPolicy()
+		return func(config *common.Config) error {
+			group := lookupConfigGroup(config.ChannelGroup, o.Path)
+			modPolicy := adminsPolicyKey
+			if cur, ok := group.Policies[o.Policy.Name]; ok {
+				modPolicy = cur.ModPolicy
+			}
+			if group.Policies == nil {
+				group.Policies = make(map[string]*common.ConfigPolicy)
+			}
+			group.Policies[o.Policy.Name] = &common.ConfigPolicy{Policy: policy, ModPolicy: modPolicy}
+			return nil
+		}, nil
+	case opSetCapability:
+		group := lookupConfigGroup(root, o.Path)
+		if group == nil {
+			return nil, badRequest("%s: group %s is not found", o.Op, o.Path)
+		}
+		current, err := groupCapabilities(group)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range current {
+			if compareCapabilities(c, o.Capability) > 0 {
+				return nil, badRequest("%s: %s is at %s, capabilities cannot be downgraded to %s", o.Op, o.Path, c, o.Capability)
+			}
+		}
+		value, err := proto.Marshal(&common.Capabilities{Capabilities: map[string]*common.Capability{o.Capability: {}}})
+		if err != nil {
+			return nil, err
+		}
+		return func(config *common.Config) error {
+			group := lookupConfigGroup(config.ChannelGroup, o.Path)
+			modPolicy := adminsPolicyKey
+			if v, ok := group.Values[capabilitiesKey]; ok {
+				modPolicy = v.ModPolicy
+			}
+			if group.Values == nil {
+				group.Values = make(map[string]*common.ConfigValue)
+			}
+			group.Values[capabilitiesKey] = &common.ConfigValue{Value: value, ModPolicy: modPolicy}
+			return nil
+		}, nil
+	case opSetBatchSize:
+		og := root.GetGroups()[ordererGroupKey]
+		if og == nil {
+			return nil, badRequest("%s: the channel has no orderer group", o.Op)
+		}
+		bs, bt := &orderer.BatchSize{}, &orderer.BatchTimeout{}
+		if v, ok := og.Values[batchSizeKey]; ok {
+			if err := proto.Unmarshal(v.Value, bs); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", batchSizeKey, err)
+			}
+		}
+		if v, ok := og.Values[batchTimeoutKey]; ok {
+			if err := proto.Unmarshal(v.Value, bt); err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", batchTimeoutKey, err)
+			}
+		}
+		if o.Batch.MaxMessageCount != 0 {
+			bs.MaxMessageCount = o.Batch.MaxMessageCount
+		}
+		if o.Batch.AbsoluteMaxBytes != 0 {
+			bs.AbsoluteMaxBytes = o.Batch.AbsoluteMaxBytes
+		}
+		if o.Batch.PreferredMaxBytes != 0 {
+			bs.PreferredMaxBytes = o.Batch.PreferredMaxBytes
+		}
+		if o.Batch.timeout != 0 {
+			bt.Timeout = o.Batch.timeout.String()
+		}
+		if bs.PreferredMaxBytes > bs.AbsoluteMaxBytes {
+			return nil, badRequest("%s: preferredMaxBytes %d exceeds absoluteMaxBytes %d", o.Op, bs.PreferredMaxBytes, bs.AbsoluteMaxBytes)
+		}
+		values := make(map[string][]byte)
+		var err error
+		if values[batchSizeKey], err = proto.Marshal(bs); err != nil {
+			return nil, err
+		}
+		if values[batchTimeoutKey], err = proto.Marshal(bt); err != nil {
+			return nil, err
+		}
+		return func(config *common.Config) error {
+			og := config.ChannelGroup.Groups[ordererGroupKey]
+			if og.Values == nil {
+				og.Values = make(map[string]*common.ConfigValue)
+			}
+			for key, value := range values {
+				modPolicy := adminsPolicyKey
+				if v, ok := og.Values[key]; ok {
+					modPolicy = v.ModPolicy
+				}
+				og.Values[key] = &common.ConfigValue{Value: value, ModPolicy: modPolicy}
+			}
+			return nil
+		}, nil
+	case opSetRevocationList:
+		group := lookupConfigGroup(root, o.Path)
+		if group == nil || group.Values[mspKey] == nil {
+			return nil, badRequest("%s: %s is not an org of the channel", o.Op, o.Path)
+		}
+		var crls [][]byte
+		for _, path := range o.CRLs {
+			crl, err := readPEMFile(path, "X509 CRL", func(der []byte) error {
+				_, err := x509.ParseDERCRL(der)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			crls = append(crls, crl)
+		}
+		return func(config *common.Config) error {
+			v := lookupConfigGroup(config.ChannelGroup, o.Path).Values[mspKey]
+			mc, conf := &mspproto.MSPConfig{}, &mspproto.FabricMSPConfig{}
+			if err := proto.Unmarshal(v.Value, mc); err != nil {
+				return fmt.Errorf("invalid %s: %v", mspKey, err)
+			}
+			if err := proto.Unmarshal(mc.Config, conf); err != nil {
+				return fmt.Errorf("invalid %s: %v", mspKey, err)
+			}
+			conf.RevocationList = crls
+			var err error
+			if mc.Config, err = proto.Marshal(conf); err != nil {
+				return err
+			}
+			value, err := proto.Marshal(mc)
+			if err != nil {
+				return err
+			}
+			v.Value = value
+			return nil
+		}, nil
+	case opSetACLs:
+		app := root.GetGroups()[applicationGroupKey]
+		if app == nil {
+			return nil, badRequest("%s: the channel has no application group", o.Op)
+		}
+		acls, err := channelACLs(config)
+		if err != nil {
+			return nil, err
+		}
+		for resource, ref := range o.ACLs {
+			if ref == "" {
+				if _, ok := acls[resource]; !ok {
+					return nil, badRequest("%s: the channel has no ACL for %s", o.Op, resource)
+				}
+				continue
+			}
+			path := ref
+			if !strings.HasPrefix(ref, "/") {
+				// relative references resolve against the application group
+				path = "/Channel/" + applicationGroupKey + "/" + ref
+			}
+			if lookupConfigPolicy(root, path) == nil {
+				return nil, badRequest("%s: %s: policy %s is not found", o.Op, resource, ref)
+			}
+		}
+		return func(config *common.Config) error {
+			app := config.ChannelGroup.Groups[applicationGroupKey]
+			acls := &pb.ACLs{Acls: make(map[string]*pb.APIResource)}
+			modPolicy := adminsPolicyKey
+			if v, ok := app.Values[aclsKey]; ok {
+				if err := proto.Unmarshal(v.Value, acls); err != nil {
+					return err
+				}
+				if acls.Acls == nil {
+					acls.Acls = make(map[string]*pb.APIResource)
+				}
+				modPolicy = v.ModPolicy
+			}
+			for resource, ref := range o.ACLs {
+				if ref == "" {
+					delete(acls.Acls, resource)
+					continue
+				}
+				acls.Acls[resource] = &pb.APIResource{PolicyRef: ref}
+			}
+			value, err := proto.Marshal(acls)
+			if err != nil {
+				return err
+			}
+			if app.Values == nil {
+				app.Values = make(map[string]*common.ConfigValue)
+			}
+			app.Values[aclsKey] = &common.ConfigValue{Value: value, ModPolicy: modPolicy}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown config operation %q", o.Op)
+}
+
+// checkOrgs makes sure added orgs are new and updated or deleted ones exist in the group.
+func (o *configOperation) checkOrgs(group *common.ConfigGroup, what string) error {
+	if group == nil {
+		return badRequest("%s: the channel has no %s group", o.Op, what)
+	}
+	for _, org := range o.Orgs {
+		_, exists := group.Groups[org.Name]
+		if strings.HasPrefix(o.Op, "add") && exists {
+			return badRequest("%s: %s is already a %s org", o.Op, org.Name, what)
+		}
+		if strings.HasPrefix(o.Op, "update") && !exists {
+			return badRequest("%s: %s is not a %s org", o.Op, org.Name, what)
+		}
+	}
+	for _, name := range o.OrgNames {
+		if _, exists := group.Groups[name]; !exists {
+			return badRequest("%s: %s is not a %s org", o.Op, name, what)
+		}
+	}
+	return nil
+}
+
+// consenter reads the TLS certificates of the consenter, the config carries them as PEM.
+func (c raftConsenterRequest) consenter() (etcdraft.Consenter, error) {
+	client, err := readPEMFile(c.ClientTLSCert, "CERTIFICATE", parseCertificateDER)
+	if err != nil {
+		return etcdraft.Consenter{}, err
+	}
+	server, err := readPEMFile(c.ServerTLSCert, "CERTIFICATE", parseCertificateDER)
+	if err != nil {
+		return etcdraft.Consenter{}, err
+	}
+	return etcdraft.Consenter{Host: c.Host, Port: c.Port, ClientTlsCert: client, ServerTlsCert: server}, nil
+}
+
+// updateConsenterCerts replaces the TLS certificates of the raft consenters of config that have the
+// host and port of one of consenters.
+func updateConsenterCerts(config *common.Config, consenters []etcdraft.Consenter) error {
+	v := config.GetChannelGroup().GetGroups()[ordererGroupKey].GetValues()[consensusTypeKey]
+	if v == nil {
+		return nil
+	}
+	ct := &orderer.ConsensusType{}
+	if err := proto.Unmarshal(v.Value, ct); err != nil {
+		return fmt.Errorf("invalid %s: %v", consensusTypeKey, err)
+	}
+	if ct.Type != "etcdraft" {
+		return nil
+	}
+	md := &etcdraft.ConfigMetadata{}
+	if err := proto.Unmarshal(ct.Metadata, md); err != nil {
+		return fmt.Errorf("invalid etcdraft metadata: %v", err)
+	}
+	for _, cur := range md.Consenters {
+		for _, c := range consenters {
+			if cur.Host == c.Host && cur.Port == c.Port {
+				cur.ClientTlsCert, cur.ServerTlsCert = c.ClientTlsCert, c.ServerTlsCert
+			}
+		}
+	}
+	var err error
+	if ct.Metadata, err = proto.Marshal(md); err != nil {
+		return err
+	}
+	v.Value, err = proto.Marshal(ct)
+	return err
+}
+
+// readPEMFile returns the blocks of a PEM file, which must all be of type typ and pass parse. What
+// it returns ends up in the channel config and in dry run previews, so files holding anything else,
+// like the private keys next to the certificates, are refused.
+func readPEMFile(path, typ string, parse func(der []byte) error) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != typ {
+			return nil, badRequest("%s holds a %s block, only %s is accepted", path, block.Type, typ)
+		}
+		if err := parse(block.Bytes); err != nil {
+			return nil, badRequest("%s: invalid %s: %v", path, typ, err)
+		}
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})...)
+		data = rest
+	}
+	if len(out) == 0 {
+		return nil, badRequest("%s is not a PEM file", path)
+	}
+	return out, nil
+}
+
+// parseCertificateDER accepts x509 and SM2 certificates.
+func parseCertificateDER(der []byte) error {
+	if _, err := x509.ParseCertificate(der); err == nil {
+		return nil
+	}
+	_, err := gmx509.ParseCertificate(der)
+	return err
+}
+
+type updateChannelConfigRequest struct {
+	identityRequest
+	Operations  []configOperation `json:"operations"`
+	Description string            `json:"description,omitempty"`
+	TTL         string            `json:"ttl,omitempty"`
+	Orderer     string            `json:"orderer,omitempty"`
+
+	channelID string
+	ttl       time.Duration
+	dryRun    bool
+}
+
+func (r *updateChannelConfigRequest) validate() error {
+	r.setDefaults()
+	if len(r.Operations) == 0 {
+		return fmt.Errorf("operations is required")
+	}
+	var ops []string
+	for i := range r.Operations {
+		if err := r.Operations[i].validate(); err != nil {
+			return err
+		}
+		ops = append(ops, r.Operations[i].Op)
+	}
+	if r.Description == "" {
+		r.Description = strings.Join(ops, ", ")
+	}
+	ttl, err := parseProposalTTL(r.TTL)
+	if err != nil {
+		return err
+	}
+	r.ttl = ttl
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// channelConfig serves GET and POST /channel/{channelID}/config.
+func channelConfig(w http.ResponseWriter, r *http.Request, channelID string) {
+	switch r.Method {
+	case http.MethodGet:
+		identity, orderer := configQuery(r)
+		result, err := doGetChannelConfig(sdkProfileOf(r), identity, channelID, orderer)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{Result: result})
+	default:
+		dryRun, err := isDryRun(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		req := updateChannelConfigRequest{channelID: channelID, dryRun: dryRun}
+		if err := decodeRequest(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		p, err := doUpdateChannelConfig(sdkProfileOf(r), &req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+	}
+}
+
+func doGetChannelConfig(profile sdkProfile, identity identityRequest, channelID, orderer string) (result *inspectResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	block, _, err := queryChannelConfig(sdk, identity, channelID, orderer)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(block)
+	if err != nil {
+		return nil, err
+	}
+	return doInspectBlock(data)
+}
+
+// doUpdateChannelConfig applies the operations to the latest config and proposes the difference. The
+// proposal is submitted right away when the request identity's signature satisfies its mod_policies.
+// On a dry run it is only previewed.
+func doUpdateChannelConfig(profile sdkProfile, req *updateChannelConfigRequest) (p *configProposal, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	_, config, err := queryChannelConfig(sdk, req.identityRequest, req.channelID, req.Orderer)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := applyConfigOperations(req.channelID, config, req.Operations)
+	if err != nil {
+		return nil, err
+	}
+	return newConfigProposal(sdk, req.identityRequest, req.channelID, req.Description, config, tx, req.ttl, req.Orderer, true, req.dryRun)
+}
+
+// applyConfigOperations applies the operations to config and returns the resulting config update tx.
+func applyConfigOperations(channelID string, config *common.Config, ops []configOperation) ([]byte, error) {
+	var opts []genesisconfig.ConfOption
+	for i := range ops {
+		opt, err := ops[i].confOption(config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	newConfig, err := genesisconfig.UpdateChannelConfig(config, opts...)
+	if err != nil {
+		return nil, badRequest("error updating channel config: %v", err)
+	}
+	return configUpdateTxOf(channelID, config, newConfig)
+}
+
+// commitConfigUpdate signs tx by every signer, checks that the signatures satisfy its mod_policies,
+// submits it and waits for a config block newer than block for which committed returns true.
+func commitConfigUpdate(sdk *pooledSDK, identity identityRequest, signers []identityRequest, channelID, orderer string, timeout time.Duration,
+	block *common.Block, config *common.Config, tx []byte, committed func(*common.Config) (bool, error)) (string, uint64, error) {
+	var sigs []*common.ConfigSignature
+	for _, signer := range signers {
+		sig, err := signConfigUpdate(sdk, signer, tx)
+		if err != nil {
+			return "", 0, fmt.Errorf("signer %s@%s: %v", signer.User, signer.Org, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	_, update, err := parseConfigUpdate(channelID, tx)
+	if err != nil {
+		return "", 0, err
+	}
+	policies, err := checkModPolicies(config.ChannelGroup, update, sigs)
+	if err != nil {
+		return "", 0, err
+	}
+	for _, p := range policies {
+		if !p.Satisfied {
+			return "", 0, badRequest("the signers do not satisfy %s (%s %s)", p.Path, p.Type, p.Rule)
+		}
+	}
+
+	resMgmtClient, err := sdk.resmgmtClient(identity.Org, identity.User)
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := resMgmtClient.SaveChannel(resmgmt.SaveChannelRequest{
+		ChannelID:     channelID,
+		ChannelConfig: bytes.NewReader(tx),
+	}, resmgmt.WithConfigSignatures(sigs...), resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(orderer))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to submit config update: %v", err)
+	}
+	txID := string(resp.TransactionID)
+
+	// the orderer only acknowledges the broadcast, wait for the config block
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(configCommitPollInterval)
+		latest, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+		if err == nil && latest.Header.Number > block.Header.Number {
+			ok, err := committed(config)
+			if err != nil {
+				return txID, 0, err
+			}
+			if ok {
+				return txID, latest.Header.Number, nil
+			}
+			block = latest
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return txID, 0, fmt.Errorf("tx %s is not committed in %v: %v", txID, timeout, err)
+			}
+			return txID, 0, fmt.Errorf("tx %s is not committed in %v", txID, timeout)
+		}
+	}
+}
+
+// configUpdateTxOf computes the update from the current to the new config and wraps it in an envelope.
+func configUpdateTxOf(channelID string, current, updated *common.Config) ([]byte, error) {
+	update, err := resmgmt.CalculateConfigUpdate(channelID, current, updated)
+	if err != nil {
+		if strings.Contains(err.Error(), "no differences detected") {
+			return nil, badRequest("the operations do not change the config of %s", channelID)
+		}
+		return nil, fmt.Errorf("error computing config update: %v", err)
+	}
+	data, err := proto.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	return configUpdateTx(channelID, data)
+}
+
+// queryChannelConfig fetches the latest config block of the channel from the orderer.
+func queryChannelConfig(sdk *pooledSDK, identity identityRequest, channelID, orderer string) (*common.Block, *common.Config, error) {
+	resMgmtClient, err := sdk.resmgmtClient(identity.Org, identity.User)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := resMgmtClient.QueryConfigBlockFromOrderer(channelID, resmgmt.WithOrdererEndpoint(orderer))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query config block of %s: %v", channelID, err)
+	}
+	_, configEnv, err := blockConfigEnvelope(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	if configEnv.GetConfig().GetChannelGroup() == nil {
+		return nil, nil, fmt.Errorf("config block of %s has no channel group", channelID)
+	}
+	return block, configEnv.Config, nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource/genesisconfig"
+)
+
+// raft options as in the sample configtx.yaml
+const (
+	defaultRaftTickInterval         = "500ms"
+	defaultRaftElectionTick         = 10
+	defaultRaftHeartbeatTick        = 1
+	defaultRaftMaxInflightBlocks    = 5
+	defaultRaftSnapshotIntervalSize = 16 * 1024 * 1024
+)
+
+const (
+	defaultBatchTimeout         = "2s"
+	defaultBatchMaxMessageCount = 10
+	// 2022-12-01 08:55:23.780 UTC [orderer.common.broadcast] ProcessMessage -> WARN 014 [channel: mychannel] Rejecting broadcast of config message from 172.26.0.1:35544 because of error: message payload is 22798 bytes and exceeds maximum allowed 4096 bytes
+	defaultBatchAbsoluteMaxBytes  = 103809024
+	defaultBatchPreferredMaxBytes = 524288
+)
+
+// batchRequest is the block cutting configuration of the orderer.
+type batchRequest struct {
+	Timeout           string `json:"timeout,omitempty"` // e.g. 2s
+	MaxMessageCount   uint32 `json:"maxMessageCount,omitempty"`
+	AbsoluteMaxBytes  uint32 `json:"absoluteMaxBytes,omitempty"`
+	PreferredMaxBytes uint32 `json:"preferredMaxBytes,omitempty"`
+
+	timeout time.Duration
+}
+
+func (r *batchRequest) validate() error {
+	if r.Timeout == "" {
+		r.Timeout = defaultBatchTimeout
+	}
+	timeout, err := parseTimeout("batch timeout", r.Timeout)
+	if err != nil {
+		return err
+	}
+	r.timeout = timeout
+	if r.MaxMessageCount == 0 {
+		r.MaxMessageCount = defaultBatchMaxMessageCount
+	}
+	if r.AbsoluteMaxBytes == 0 {
+		r.AbsoluteMaxBytes = defaultBatchAbsoluteMaxBytes
+	}
+	if r.PreferredMaxBytes == 0 {
+		r.PreferredMaxBytes = defaultBatchPreferredMaxBytes
+	}
+	if r.PreferredMaxBytes > r.AbsoluteMaxBytes {
+		return fmt.Errorf("batch preferredMaxBytes %d exceeds absoluteMaxBytes %d", r.PreferredMaxBytes, r.AbsoluteMaxBytes)
+	}
+	return nil
+}
+
+// etcdRaftRequest describes the raft cluster of the orderer. TLS certificates are paths to PEM files,
+// like in configtx.yaml.
+type etcdRaftRequest struct {
+	Consenters []raftConsenterRequest `json:"consenters"`
+	Options    *raftOptionsRequest    `json:"options,omitempty"`
+}
+
+type raftConsenterRequest struct {
+	Host          string `json:"host"`
+	Port          uint32 `json:"port"`
+	ClientTLSCert string `json:"clientTLSCert"`
+	ServerTLSCert string `json:"serverTLSCert"`
+}
+
+type raftOptionsRequest struct {
+	TickInterval         string `json:"tickInterval,omitempty"`
+	ElectionTick         uint32 `json:"electionTick,omitempty"`
+	HeartbeatTick        uint32 `json:"heartbeatTick,omitempty"`
+	MaxInflightBlocks    uint32 `json:"maxInflightBlocks,omitempty"`
+	SnapshotIntervalSize uint32 `json:"snapshotIntervalSize,omitempty"` // bytes
+}
+
+func (r *etcdRaftRequest) validate() error {
+	if len(r.Consenters) == 0 {
+		return fmt.Errorf("etcdRaft consenters is required")
+	}
+	seen := make(map[string]bool)
+	for _, c := range r.Consenters {
+		if c.Host == "" || c.Port == 0 || c.Port > 65535 {
+			return fmt.Errorf("invalid etcdRaft consenter %s:%d", c.Host, c.Port)
+		}
+		endpoint := fmt.Sprintf("%s:%d", c.Host, c.Port)
+		if seen[endpoint] {
+			return fmt.Errorf("duplicate etcdRaft consenter %s", endpoint)
+		}
+		seen[endpoint] = true
+		if err := checkCertFile(endpoint, "clientTLSCert", c.ClientTLSCert); err != nil {
+			return err
+		}
+		if err := checkCertFile(endpoint, "serverTLSCert", c.ServerTLSCert); err != nil {
+			return err
+		}
+	}
+	if r.Options == nil {
+		r.Options = &raftOptionsRequest{}
+	}
+	o := r.Options
+	if o.TickInterval == "" {
+		o.TickInterval = defaultRaftTickInterval
+	}
+	if _, err := parseTimeout("etcdRaft tickInterval", o.TickInterval); err != nil {
+		return err
+	}
+	if o.ElectionTick == 0 {
+		o.ElectionTick = defaultRaftElectionTick
+	}
+	if o.HeartbeatTick == 0 {
+		o.HeartbeatTick = defaultRaftHeartbeatTick
+	}
+	if o.ElectionTick <= o.HeartbeatTick {
+		return fmt.Errorf("etcdRaft electionTick %d must be greater than heartbeatTick %d", o.ElectionTick, o.HeartbeatTick)
+	}
+	if o.MaxInflightBlocks == 0 {
+		o.MaxInflightBlocks = defaultRaftMaxInflightBlocks
+	}
+	if o.SnapshotIntervalSize == 0 {
+		o.SnapshotIntervalSize = defaultRaftSnapshotIntervalSize
+	}
+	return nil
+}
+
+// configMetadata returns the raft metadata of the genesis profile. As in configtxgen the certificates
+// are still file paths here, the encoder reads them when the block is built.
+func (r *etcdRaftRequest) configMetadata() *etcdraft.ConfigMetadata {
+	md := &etcdraft.ConfigMetadata{
+		Options: &etcdraft.Options{
+			TickInterval:         r.Options.TickInterval,
+			ElectionTick:         r.Options.ElectionTick,
+			HeartbeatTick:        r.Options.HeartbeatTick,
+			MaxInflightBlocks:    r.Options.MaxInflightBlocks,
+			SnapshotIntervalSize: r.Options.SnapshotIntervalSize,
+		},
+	}
+	for _, c := range r.Consenters {
+		md.Consenters = append(md.Consenters, &etcdraft.Consenter{
+			Host:          c.Host,
+			Port:          c.Port,
+			ClientTlsCert: []byte(c.ClientTLSCert),
+			ServerTlsCert: []byte(c.ServerTLSCert),
+		})
+	}
+	return md
+}
+
+func checkCertFile(owner, field, path string) error {
+	if path == "" {
+		return fmt.Errorf("%s: %s is required", owner, field)
+	}
+	if strings.HasPrefix(path, "-----BEGIN") {
+		return fmt.Errorf("%s: %s must be the path of a PEM file", owner, field)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %s: %v", owner, field, err)
+	}
+	return nil
+}
+
+// ybft timeouts, the consensus grows each round's timeout by its delta
+const (
+	defaultPBFTProposeTimeout        = "3s"
+	defaultPBFTProposeDeltaTimeout   = "500ms"
+	defaultPBFTPrevoteTimeout        = "1s"
+	defaultPBFTPrevoteDeltaTimeout   = "500ms"
+	defaultPBFTPrecommitTimeout      = "1s"
+	defaultPBFTPrecommitDeltaTimeout = "500ms"
+)
+
+// pbftRequest describes the Ybft cluster of the orderer. Certificates are paths to PEM files.
+type pbftRequest struct {
+	Consenters []pbftConsenterRequest `json:"consenters"`
+	Options    *pbftOptionsRequest    `json:"options,omitempty"`
+}
+
+type pbftConsenterRequest struct {
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	ClientTLSCert string `json:"clientTLSCert"`
+	ServerTLSCert string `json:"serverTLSCert"`
+	MSPID         string `json:"mspID"`
+	MSPCert       string `json:"mspCert"` // signing certificate of the consenter
+}
+
+type pbftOptionsRequest struct {
+	ProposeTimeout        string `json:"proposeTimeout,omitempty"`
+	ProposeDeltaTimeout   string `json:"proposeDeltaTimeout,omitempty"`
+	PrevoteTimeout        string `json:"prevoteTimeout,omitempty"`
+	PrevoteDeltaTimeout   string `json:"prevoteDeltaTimeout,omitempty"`
+	PrecommitTimeout      string `json:"precommitTimeout,omitempty"`
+	PrecommitDeltaTimeout string `json:"precommitDeltaTimeout,omitempty"`
+	ProposeBlocks         uint32 `json:"proposeBlocks,omitempty"`
+}
+
+// bftFaultTolerance returns how many faulty nodes a cluster of n tolerates, n >= 3f+1.
+func bftFaultTolerance(n int) int {
+	return (n - 1) / 3
+}
+
+func (r *pbftRequest) validate(ordererMSPs map[string]bool) error {
+	n := len(r.Consenters)
+	if n == 0 {
+		return fmt.Errorf("pbft consenters is required")
+	}
+	f := bftFaultTolerance(n)
+	if f < 1 {
+		return fmt.Errorf("pbft needs at least 4 consenters to tolerate one faulty node (3f+1), got %d", n)
+	}
+	if n != 3*f+1 {
+		log.Printf("%d pbft consenters tolerate %d faulty nodes, the same as %d consenters\n", n, f, 3*f+1)
+	}
+	seen := make(map[string]bool)
+	for _, c := range r.Consenters {
+		if c.Host == "" || c.Port <= 0 || c.Port > 65535 {
+			return fmt.Errorf("invalid pbft consenter %s:%d", c.Host, c.Port)
+		}
+		endpoint := fmt.Sprintf("%s:%d", c.Host, c.Port)
+		if seen[endpoint] {
+			return fmt.Errorf("duplicate pbft consenter %s", endpoint)
+		}
+		seen[endpoint] = true
+		if c.MSPID == "" {
+			return fmt.Errorf("%s: mspID is required", endpoint)
+		}
+		if !ordererMSPs[c.MSPID] {
+			return fmt.Errorf("%s: mspID %s is not one of the orderer orgs", endpoint, c.MSPID)
+		}
+		for _, cert := range []struct{ field, path string }{
+			{"clientTLSCert", c.ClientTLSCert},
+			{"serverTLSCert", c.ServerTLSCert},
+			{"mspCert", c.MSPCert},
+		} {
+			if err := checkCertFile(endpoint, cert.field, cert.path); err != nil {
+				return err
+			}
+		}
+	}
+	if r.Options == nil {
+		r.Options = &pbftOptionsRequest{}
+	}
+	o := r.Options
+	// the encoder parses these as well, but only after reading every certificate and
+	// with one message for all of them
+	for _, t := range []struct {
+		field string
+		value *string
+		def   string
+	}{
+		{"proposeTimeout", &o.ProposeTimeout, defaultPBFTProposeTimeout},
+		{"proposeDeltaTimeout", &o.ProposeDeltaTimeout, defaultPBFTProposeDeltaTimeout},
+		{"prevoteTimeout", &o.PrevoteTimeout, defaultPBFTPrevoteTimeout},
+		{"prevoteDeltaTimeout", &o.PrevoteDeltaTimeout, defaultPBFTPrevoteDeltaTimeout},
+		{"precommitTimeout", &o.PrecommitTimeout, defaultPBFTPrecommitTimeout},
+		{"precommitDeltaTimeout", &o.PrecommitDeltaTimeout, defaultPBFTPrecommitDeltaTimeout},
+	} {
+		if *t.value == "" {
+			*t.value = t.def
+		}
+		if _, err := parseTimeout("pbft "+t.field, *t.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configMetadata returns the Ybft metadata of the genesis profile, certificates are read by the encoder.
+func (r *pbftRequest) configMetadata() *genesisconfig.YbftConfigMetadata {
+	md := &genesisconfig.YbftConfigMetadata{
+		Options: &genesisconfig.YbftOptions{
+			ProposeTimeout:        r.Options.ProposeTimeout,
+			ProposeDeltaTimeout:   r.Options.ProposeDeltaTimeout,
+			PrevoteTimeout:        r.Options.PrevoteTimeout,
+			PrevoteDeltaTimeout:   r.Options.PrevoteDeltaTimeout,
+			PrecommitTimeout:      r.Options.PrecommitTimeout,
+			PrecommitDeltaTimeout: r.Options.PrecommitDeltaTimeout,
+			ProposeBlocks:         r.Options.ProposeBlocks,
+		},
+	}
+	for _, c := range r.Consenters {
+		md.Consenters = append(md.Consenters, &genesisconfig.YbftConsenter{
+			Host:          c.Host,
+			Port:          c.Port,
+			ClientTlsCert: c.ClientTLSCert,
+			ServerTlsCert: c.ServerTLSCert,
+			MspId:         c.MSPID,
+			MspCert:       c.MSPCert,
+		})
+	}
+	return md
+}
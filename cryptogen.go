@@ -0,0 +1,626 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Hyperledger-TWGC/ccs-gm/sm2"
+	"github.com/Hyperledger-TWGC/ccs-gm/sm3"
+	gmutils "github.com/Hyperledger-TWGC/ccs-gm/utils"
+	gmx509 "github.com/Hyperledger-TWGC/ccs-gm/x509"
+	"github.com/golang/protobuf/proto"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+)
+
+const (
+	cryptoAlgorithmECDSA = "ecdsa" // ECDSA-P256 with SHA2
+	cryptoAlgorithmSM2   = "sm2"   // SM2 with SM3
+
+	cryptoOutputTar = "tar"
+	cryptoOutputDir = "dir"
+	// crypto material generated with output dir is written below here, one directory per OutputDir
+	cryptoStoreDir = "./crypto"
+
+	certValidity = 10 * 365 * 24 * time.Hour
+)
+
+// cryptoGenRequest is the gateway's counterpart of a cryptogen crypto-config.yaml.
+type cryptoGenRequest struct {
+	// Algorithm defaults to sm2 under /gm and to ecdsa otherwise
+	Algorithm   string          `json:"algorithm,omitempty"`
+	OrdererOrgs []cryptoOrgSpec `json:"ordererOrgs,omitempty"`
+	PeerOrgs    []cryptoOrgSpec `json:"peerOrgs,omitempty"`
+	// Output is tar (a .tar.gz in the response or the artifact store) or dir (written to
+	// ./crypto/<outputDir> on the gateway host, OutputDir is a plain name)
+	Output    string `json:"output,omitempty"`
+	OutputDir string `json:"outputDir,omitempty"`
+	Store     bool   `json:"store,omitempty"`
+}
+
+type cryptoOrgSpec struct {
+	Name          string           `json:"name"`
+	Domain        string           `json:"domain"`
+	EnableNodeOUs bool             `json:"enableNodeOUs"`
+	CA            cryptoSubject    `json:"ca"`
+	Specs         []cryptoNodeSpec `json:"specs,omitempty"`
+	Template      struct {
+		Count int      `json:"count"`
+		Start int      `json:"start"`
+		SANS  []string `json:"sans,omitempty"`
+	} `json:"template"`
+	Users struct {
+		Count int `json:"count"`
+	} `json:"users"`
+}
+
+type cryptoSubject struct {
+	Country            string `json:"country,omitempty"`
+	Province           string `json:"province,omitempty"`
+	Locality           string `json:"locality,omitempty"`
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+}
+
+type cryptoNodeSpec struct {
+	Hostname   string   `json:"hostname"`
+	CommonName string   `json:"commonName,omitempty"`
+	SANS       []string `json:"sans,omitempty"`
+}
+
+var cryptoDirPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*$`)
+
+func (r *cryptoGenRequest) validate() error {
+	switch r.Algorithm {
+	case cryptoAlgorithmECDSA, cryptoAlgorithmSM2:
+	default:
+		return fmt.Errorf("algorithm must be %s or %s", cryptoAlgorithmECDSA, cryptoAlgorithmSM2)
+	}
+	if r.Output == "" {
+		r.Output = cryptoOutputTar
+	}
+	switch r.Output {
+	case cryptoOutputTar:
+		if r.OutputDir != "" {
+			return fmt.Errorf("outputDir is only used with output %s", cryptoOutputDir)
+		}
+	case cryptoOutputDir:
+		if r.OutputDir == "" {
+			return fmt.Errorf("outputDir is required for output %s", cryptoOutputDir)
+		}
+		if !cryptoDirPattern.MatchString(r.OutputDir) {
+			return fmt.Errorf("invalid outputDir %q, expected a name like network1", r.OutputDir)
+		}
+		if r.Store {
+			return fmt.Errorf("store is only used with output %s", cryptoOutputTar)
+		}
+	default:
+		return fmt.Errorf("output must be %s or %s", cryptoOutputTar, cryptoOutputDir)
+	}
+	if len(r.OrdererOrgs) == 0 && len(r.PeerOrgs) == 0 {
+		return fmt.Errorf("ordererOrgs or peerOrgs is required")
+	}
+	seen := make(map[string]bool)
+	for _, orgs := range [][]cryptoOrgSpec{r.OrdererOrgs, r.PeerOrgs} {
+		for i := range orgs {
+			org := &orgs[i]
+			if err := org.validate(); err != nil {
+				return err
+			}
+			if seen[org.Domain] {
+				return fmt.Errorf("duplicate org domain %s", org.Domain)
+			}
+			seen[org.Domain] = true
+		}
+	}
+	return nil
+}
+
+func (o *cryptoOrgSpec) validate() error {
+	if o.Domain == "" || !hostnamePattern.MatchString(o.Domain) {
+		return fmt.Errorf("invalid org domain %q", o.Domain)
+	}
+	if o.Name == "" {
+		o.Name = o.Domain
+	}
+	if o.Template.Count < 0 || o.Template.Start < 0 || o.Users.Count < 0 {
+		return fmt.Errorf("org %s: template and users counts must not be negative", o.Name)
+	}
+	for _, s := range o.Specs {
+		if !hostnamePattern.MatchString(s.Hostname) {
+			return fmt.Errorf("org %s: invalid hostname %q", o.Name, s.Hostname)
+		}
+	}
+	return nil
+}
+
+// nodes returns the explicit specs followed by the template ones, as cryptogen does.
+func (o *cryptoOrgSpec) nodes(prefix string) []cryptoNodeSpec {
+	nodes := append([]cryptoNodeSpec(nil), o.Specs...)
+	for i := 0; i < o.Template.Count; i++ {
+		nodes = append(nodes, cryptoNodeSpec{
+			Hostname: fmt.Sprintf("%s%d", prefix, o.Template.Start+i),
+			SANS:     o.Template.SANS,
+		})
+	}
+	for i := range nodes {
+		if nodes[i].CommonName == "" {
+			nodes[i].CommonName = nodes[i].Hostname + "." + o.Domain
+		}
+	}
+	return nodes
+}
+
+func generateCrypto(w http.ResponseWriter, r *http.Request) {
+	var req cryptoGenRequest
+	if sdkProfileOf(r).Crypto == cryptoGM {
+		req.Algorithm = cryptoAlgorithmSM2
+	} else {
+		req.Algorithm = cryptoAlgorithmECDSA
+	}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doGenerateCrypto(&req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if result.data == nil {
+		writeResponse(w, apiResponse{Result: result})
+		return
+	}
+	writeArtifact(w, r, result)
+}
+
+func doGenerateCrypto(req *cryptoGenRequest) (*artifactResult, error) {
+	var dir string
+	if req.Output == cryptoOutputTar {
+		tmp, err := ioutil.TempDir("", "crypto-config-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	} else {
+		// never mix new keys into existing material
+		dir = filepath.Join(cryptoStoreDir, req.OutputDir)
+		if _, err := os.Stat(dir); err == nil {
+			return nil, &apiError{Status: http.StatusConflict, Message: fmt.Sprintf("crypto material %s already exists", req.OutputDir)}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	g := &cryptoGenerator{algorithm: req.Algorithm}
+	for i := range req.OrdererOrgs {
+		if err := g.generateOrg(filepath.Join(dir, "ordererOrganizations"), &req.OrdererOrgs[i], "orderer"); err != nil {
+			return nil, err
+		}
+	}
+	for i := range req.PeerOrgs {
+		if err := g.generateOrg(filepath.Join(dir, "peerOrganizations"), &req.PeerOrgs[i], "peer"); err != nil {
+			return nil, err
+		}
+	}
+	if req.Output == cryptoOutputDir {
+		return &artifactResult{Path: dir}, nil
+	}
+
+	var entries []tarEntry
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, tarEntry{name: filepath.ToSlash(rel), data: data, mode: int64(info.Mode().Perm())})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tgz, err := tarGz(entries...)
+	if err != nil {
+		return nil, err
+	}
+	// there may be no network, and no sdk, yet: hash with the algorithm the material is for
+	var result *artifactResult
+	if req.Algorithm == cryptoAlgorithmSM2 {
+		h := sm3.New()
+		h.Write(tgz)
+		result = artifactOf("crypto-config.tar.gz", tgz, "SM3", h.Sum(nil))
+	} else {
+		digest := sha256.Sum256(tgz)
+		result = artifactOf("crypto-config.tar.gz", tgz, "SHA256", digest[:])
+	}
+	if err := saveArtifact(result, req.Store); err != nil {
+		return nil, fmt.Errorf("error saving crypto material: %v", err)
+	}
+	return result, nil
+}
+
+// cryptoGenerator writes the cryptogen directory layout of an org: ca, tlsca, msp, the nodes and the users.
+type cryptoGenerator struct {
+	algorithm string
+}
+
+// cryptoCA is a CA of an org, its certificate and key.
+type cryptoCA struct {
+	name string
+	cert []byte // PEM
+	priv crypto.Signer
+	ski  []byte
+
+	std *x509.Certificate
+	gm  *gmx509.Certificate
+}
+
+func (g *cryptoGenerator) generateOrg(baseDir string, org *cryptoOrgSpec, nodeType string) error {
+	orgDir := filepath.Join(baseDir, org.Domain)
+	if _, err := os.Stat(orgDir); err == nil {
+		return badRequest("%s already exists", orgDir)
+	}
+	ca, err := g.newCA(filepath.Join(orgDir, "ca"), "ca."+org.Domain, org)
+	if err != nil {
+		return fmt.Errorf("org %s: error generating CA: %v", org.Name, err)
+	}
+	tlsCA, err := g.newCA(filepath.Join(orgDir, "tlsca"), "tlsca."+org.Domain, org)
+	if err != nil {
+		return fmt.Errorf("org %s: error generating TLS CA: %v", org.Name, err)
+	}
+
+	// without NodeOUs the admin is recognized by its certificate in admincerts
+	adminName := "Admin@" + org.Domain
+	adminOU := "client"
+	if org.EnableNodeOUs {
+		adminOU = "admin"
+	}
+	adminKey, adminCert, err := g.newSignCert(ca, adminName, adminOU, org)
+	if err != nil {
+		return err
+	}
+	var admins [][]byte
+	if !org.EnableNodeOUs {
+		admins = [][]byte{adminCert}
+	}
+
+	if err := writeVerifyingMSP(filepath.Join(orgDir, "msp"), ca, tlsCA, admins, org.EnableNodeOUs); err != nil {
+		return fmt.Errorf("org %s: error writing msp: %v", org.Name, err)
+	}
+
+	for _, node := range org.nodes(nodeType) {
+		nodeDir := filepath.Join(orgDir, nodeType+"s", node.CommonName)
+		key, cert, err := g.newSignCert(ca, node.CommonName, nodeType, org)
+		if err != nil {
+			return err
+		}
+		if err := g.writeLocalMSP(filepath.Join(nodeDir, "msp"), ca, tlsCA, admins, org.EnableNodeOUs, node.CommonName, key, cert); err != nil {
+			return err
+		}
+		sans := append([]string{node.CommonName, node.Hostname}, node.SANS...)
+		if err := g.writeTLS(filepath.Join(nodeDir, "tls"), tlsCA, node.CommonName, sans, "server", org); err != nil {
+			return err
+		}
+	}
+
+	users := []string{adminName}
+	for i := 1; i <= org.Users.Count; i++ {
+		users = append(users, fmt.Sprintf("User%d@%s", i, org.Domain))
+	}
+	for _, user := range users {
+		userDir := filepath.Join(orgDir, "users", user)
+		key, cert := adminKey, adminCert
+		if user != adminName {
+			if key, cert, err = g.newSignCert(ca, user, "client", org); err != nil {
+				return err
+			}
+		}
+		if err := g.writeLocalMSP(filepath.Join(userDir, "msp"), ca, tlsCA, admins, org.EnableNodeOUs, user, key, cert); err != nil {
+			return err
+		}
+		if err := g.writeTLS(filepath.Join(userDir, "tls"), tlsCA, user, []string{user}, "client", org); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeVerifyingMSP writes the org MSP, the one genesisconfig.Organization.MSPDir points to.
+func writeVerifyingMSP(dir string, ca, tlsCA *cryptoCA, admins [][]byte, nodeOUs bool) error {
+	config, err := proto.Marshal(&mspproto.FabricMSPConfig{
+		RootCerts:    [][]byte{ca.cert},
+		TlsRootCerts: [][]byte{tlsCA.cert},
+		Admins:       admins,
+	})
+	if err != nil {
+		return err
+	}
+	if err := resource.GenerateMspDir(dir, &mspproto.MSPConfig{Config: config}); err != nil {
+		return err
+	}
+	if nodeOUs {
+		return ioutil.WriteFile(filepath.Join(dir, "config.yaml"), nodeOUsConfig, 0640)
+	}
+	return nil
+}
+
+func (g *cryptoGenerator) writeLocalMSP(dir string, ca, tlsCA *cryptoCA, admins [][]byte, nodeOUs bool, name string, key, cert []byte) error {
+	if err := writeVerifyingMSP(dir, ca, tlsCA, admins, nodeOUs); err != nil {
+		return fmt.Errorf("%s: error writing msp: %v", name, err)
+	}
+	if err := writeFile(filepath.Join(dir, "signcerts", name+"-cert.pem"), cert, 0640); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "keystore", "priv_sk"), key, 0600)
+}
+
+func (g *cryptoGenerator) writeTLS(dir string, tlsCA *cryptoCA, name string, sans []string, role string, org *cryptoOrgSpec) error {
+	priv, pub, keyPEM, err := g.newKey()
+	if err != nil {
+		return err
+	}
+	tmpl := g.template(name, "", org)
+	tmpl.keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	tmpl.serverAuth, tmpl.clientAuth = true, true
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			tmpl.ips = append(tmpl.ips, ip)
+		} else {
+			tmpl.dnsNames = append(tmpl.dnsNames, san)
+		}
+	}
+	cert, err := g.sign(tmpl, tlsCA, pub, priv)
+	if err != nil {
+		return fmt.Errorf("%s: error signing TLS certificate: %v", name, err)
+	}
+	if err := writeFile(filepath.Join(dir, "ca.crt"), tlsCA.cert, 0640); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, role+".crt"), cert, 0640); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, role+".key"), keyPEM, 0600)
+}
+
+func (g *cryptoGenerator) newCA(dir, name string, org *cryptoOrgSpec) (*cryptoCA, error) {
+	priv, pub, keyPEM, err := g.newKey()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := g.template(name, "", org)
+	tmpl.isCA = true
+	tmpl.keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	tmpl.serverAuth, tmpl.clientAuth = true, true
+	tmpl.subjectKeyID = g.ski(pub)
+	ca := &cryptoCA{name: name, priv: priv, ski: tmpl.subjectKeyID}
+	// self-signed
+	if ca.cert, err = g.sign(tmpl, ca, pub, priv); err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(dir, name+"-cert.pem"), ca.cert, 0640); err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(dir, "priv_sk"), keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// newSignCert issues an enrollment certificate, returning its key and certificate as PEM.
+func (g *cryptoGenerator) newSignCert(ca *cryptoCA, name, ou string, org *cryptoOrgSpec) ([]byte, []byte, error) {
+	priv, pub, keyPEM, err := g.newKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !org.EnableNodeOUs {
+		ou = ""
+	}
+	tmpl := g.template(name, ou, org)
+	tmpl.keyUsage = x509.KeyUsageDigitalSignature
+	cert, err := g.sign(tmpl, ca, pub, priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: error signing certificate: %v", name, err)
+	}
+	return keyPEM, cert, nil
+}
+
+// certTemplate holds what cryptogen sets on a certificate, for either x509 implementation.
+type certTemplate struct {
+	subject      pkix.Name
+	isCA         bool
+	keyUsage     x509.KeyUsage
+	serverAuth   bool
+	clientAuth   bool
+	dnsNames     []string
+	ips          []net.IP
+	subjectKeyID []byte
+}
+
+func (g *cryptoGenerator) template(commonName, ou string, org *cryptoOrgSpec) *certTemplate {
+	subject := pkix.Name{
+		CommonName:   commonName,
+		Organization: []string{org.Domain},
+		Country:      []string{"US"},
+		Province:     []string{"California"},
+		Locality:     []string{"San Francisco"},
+	}
+	if org.CA.Country != "" {
+		subject.Country = []string{org.CA.Country}
+	}
+	if org.CA.Province != "" {
+		subject.Province = []string{org.CA.Province}
+	}
+	if org.CA.Locality != "" {
+		subject.Locality = []string{org.CA.Locality}
+	}
+	if ou != "" {
+		subject.OrganizationalUnit = []string{ou}
+	} else if org.CA.OrganizationalUnit != "" && strings.HasPrefix(commonName, "ca.") {
+		subject.OrganizationalUnit = []string{org.CA.OrganizationalUnit}
+	}
+	return &certTemplate{subject: subject}
+}
+
+func (g *cryptoGenerator) newKey() (crypto.Signer, crypto.PublicKey, []byte, error) {
+	if g.algorithm == cryptoAlgorithmSM2 {
+		priv, err := sm2.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		keyPEM, err := gmutils.PrivateKeyToPEM(priv, nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return priv, &priv.PublicKey, keyPEM, nil
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return priv, &priv.PublicKey, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ski is the hash of the public point, as cryptogen computes it.
+func (g *cryptoGenerator) ski(pub crypto.PublicKey) []byte {
+	if k, ok := pub.(*sm2.PublicKey); ok {
+		h := sm3.New()
+		h.Write(elliptic.Marshal(k.Curve, k.X, k.Y))
+		return h.Sum(nil)
+	}
+	k := pub.(*ecdsa.PublicKey)
+	sum := sha256.Sum256(elliptic.Marshal(k.Curve, k.X, k.Y))
+	return sum[:]
+}
+
+// sign issues the certificate with the CA key. A CA signing its own template is self-signed.
+func (g *cryptoGenerator) sign(t *certTemplate, ca *cryptoCA, pub crypto.PublicKey, priv crypto.Signer) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	notBefore := time.Now().Add(-5 * time.Minute).UTC()
+	selfSigned := ca.cert == nil
+	var der []byte
+	if g.algorithm == cryptoAlgorithmSM2 {
+		tmpl := &gmx509.Certificate{
+			SerialNumber:          serial,
+			Subject:               t.subject,
+			NotBefore:             notBefore,
+			NotAfter:              notBefore.Add(certValidity),
+			KeyUsage:              gmx509.KeyUsage(t.keyUsage),
+			BasicConstraintsValid: true,
+			IsCA:                  t.isCA,
+			DNSNames:              t.dnsNames,
+			IPAddresses:           t.ips,
+			SubjectKeyId:          t.subjectKeyID,
+			SignatureAlgorithm:    gmx509.SM2WithSM3,
+		}
+		if t.serverAuth {
+			tmpl.ExtKeyUsage = append(tmpl.ExtKeyUsage, gmx509.ExtKeyUsageServerAuth)
+		}
+		if t.clientAuth {
+			tmpl.ExtKeyUsage = append(tmpl.ExtKeyUsage, gmx509.ExtKeyUsageClientAuth)
+		}
+		parent := tmpl
+		if !selfSigned {
+			parent = ca.gm
+			tmpl.AuthorityKeyId = ca.ski
+		}
+		if der, err = gmx509.CreateCertificate(rand.Reader, tmpl, parent, pub, ca.signer(priv)); err != nil {
+			return nil, err
+		}
+		if selfSigned {
+			if ca.gm, err = gmx509.ParseCertificate(der); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		tmpl := &x509.Certificate{
+			SerialNumber:          serial,
+			Subject:               t.subject,
+			NotBefore:             notBefore,
+			NotAfter:              notBefore.Add(certValidity),
+			KeyUsage:              t.keyUsage,
+			BasicConstraintsValid: true,
+			IsCA:                  t.isCA,
+			DNSNames:              t.dnsNames,
+			IPAddresses:           t.ips,
+			SubjectKeyId:          t.subjectKeyID,
+		}
+		if t.serverAuth {
+			tmpl.ExtKeyUsage = append(tmpl.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+		}
+		if t.clientAuth {
+			tmpl.ExtKeyUsage = append(tmpl.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+		}
+		parent := tmpl
+		if !selfSigned {
+			parent = ca.std
+			tmpl.AuthorityKeyId = ca.ski
+		}
+		if der, err = x509.CreateCertificate(rand.Reader, tmpl, parent, pub, ca.signer(priv)); err != nil {
+			return nil, err
+		}
+		if selfSigned {
+			if ca.std, err = x509.ParseCertificate(der); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// signer is the key certificates are signed with: the CA key, or the subject's own key while the
+// CA certificate itself is being created.
+func (ca *cryptoCA) signer(own crypto.Signer) crypto.Signer {
+	if ca.cert == nil {
+		return own
+	}
+	return ca.priv
+}
+
+// nodeOUsConfig is the msp config.yaml cryptogen writes with EnableNodeOUs, resource.GenerateMspDir
+// stores the CA certificate as cacerts/cert0.pem.
+var nodeOUsConfig = []byte(`NodeOUs:
+  Enable: true
+  ClientOUIdentifier:
+    Certificate: cacerts/cert0.pem
+    OrganizationalUnitIdentifier: client
+  PeerOUIdentifier:
+    Certificate: cacerts/cert0.pem
+    OrganizationalUnitIdentifier: peer
+  AdminOUIdentifier:
+    Certificate: cacerts/cert0.pem
+    OrganizationalUnitIdentifier: admin
+  OrdererOUIdentifier:
+    Certificate: cacerts/cert0.pem
+    OrganizationalUnitIdentifier: orderer
+`)
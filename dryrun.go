@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+)
+
+// configSetElement is one element of the read or write set of a config update. Old and New are the
+// element as in the current config and as written, decoded like configtxlator does.
+type configSetElement struct {
+	// Path is prefixed with the element kind like configChange.Path
+	Path      string          `json:"path"`
+	Action    string          `json:"action,omitempty"` // added, removed or modified, write set only
+	Version   uint64          `json:"version"`
+	ModPolicy string          `json:"modPolicy,omitempty"`
+	Old       json.RawMessage `json:"old,omitempty"`
+	New       json.RawMessage `json:"new,omitempty"`
+}
+
+// isDryRun reports whether the request asks, with ?dryRun=true, for what it would change only.
+func isDryRun(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("dryRun")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, badRequest("invalid dryRun %q", v)
+	}
+	return dryRun, nil
+}
+
+// dryRunConfigUpdate previews tx, computed from current and signed by every signer, without
+// submitting it. It also returns the config tx results in, so that the next update of a request
+// that changes a channel step by step can be previewed on top of it.
+func dryRunConfigUpdate(sdk *pooledSDK, identity identityRequest, signers []identityRequest, channelID, orderer string, current *common.Config, tx []byte) (*configProposal, *common.Config, error) {
+	now := time.Now()
+	p := &configProposal{
+		ChannelID:  channelID,
+		Status:     proposalDryRun,
+		CreatedBy:  identity.User + "@" + identity.Org,
+		CreatedAt:  now,
+		ExpiresAt:  now,
+		Orderer:    orderer,
+		UpdateTx:   tx,
+		Signatures: []proposalSignature{},
+	}
+	for _, signer := range signers {
+		sig, err := signConfigUpdate(sdk, signer, tx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("signer %s@%s: %v", signer.User, signer.Org, err)
+		}
+		if err := p.addSignature(sig); err != nil {
+			return nil, nil, err
+		}
+	}
+	updated, err := p.preview(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, updated, nil
+}
+
+// preview fills in what the update of the proposal changes in current, its read and write sets and
+// the mod_policies its signatures have to satisfy. It returns the config the update results in.
+func (p *configProposal) preview(current *common.Config) (*common.Config, error) {
+	_, update, err := parseConfigUpdate(p.ChannelID, p.UpdateTx)
+	if err != nil {
+		return nil, err
+	}
+	updated := mergeConfigUpdate(current, update)
+	p.Changes = configDiff(current, updated)
+
+	sigs, err := p.configSignatures()
+	if err != nil {
+		return nil, err
+	}
+	if p.Policies, err = checkModPolicies(current.ChannelGroup, update, sigs); err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	written, err := decodedWriteSet(p.UpdateTx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := proto.Marshal(&common.ConfigUpdate{ChannelId: p.ChannelID, WriteSet: current.ChannelGroup})
+	if err != nil {
+		return nil, err
+	}
+	if tx, err = configUpdateTx(p.ChannelID, tx); err != nil {
+		return nil, err
+	}
+	old, err := decodedWriteSet(tx)
+	if err != nil {
+		return nil, err
+	}
+	p.ReadSet = []configSetElement{}
+	readSetElements("/Channel", update.ReadSet, &p.ReadSet)
+	p.WriteSet = []configSetElement{}
+	writeSetElements("/Channel", current.ChannelGroup, update.WriteSet, old, written, &p.WriteSet)
+	return updated, nil
+}
+
+// mergeConfigUpdate returns the config that results from applying update to current.
+func mergeConfigUpdate(current *common.Config, update *common.ConfigUpdate) *common.Config {
+	updated := proto.Clone(current).(*common.Config)
+	updated.ChannelGroup = mergeWriteSet(current.ChannelGroup, update.WriteSet)
+	return updated
+}
+
+// mergeWriteSet returns the group that results from writing write over current, the way the orderer
+// does: elements at the version of current are kept, and members left out of a group written at a
+// new version are removed.
+func mergeWriteSet(current, write *common.ConfigGroup) *common.ConfigGroup {
+	if write == nil {
+		return current
+	}
+	if current == nil {
+		return write
+	}
+	g := &common.ConfigGroup{
+		Version:   current.Version,
+		ModPolicy: current.ModPolicy,
+		Groups:    make(map[string]*common.ConfigGroup),
+		Values:    make(map[string]*common.ConfigValue),
+		Policies:  make(map[string]*common.ConfigPolicy),
+	}
+	rewritten := write.Version != current.Version
+	if rewritten {
+		g.Version, g.ModPolicy = write.Version, write.ModPolicy
+	} else {
+		for name, v := range current.Values {
+			g.Values[name] = v
+		}
+		for name, cp := range current.Policies {
+			g.Policies[name] = cp
+		}
+		for name, sub := range current.Groups {
+			g.Groups[name] = sub
+		}
+	}
+	for name, v := range write.Values {
+		if cur, ok := current.Values[name]; ok && cur.Version == v.Version {
+			v = cur
+		}
+		g.Values[name] = v
+	}
+	for name, cp := range write.Policies {
+		if cur, ok := current.Policies[name]; ok && cur.Version == cp.Version {
+			cp = cur
+		}
+		g.Policies[name] = cp
+	}
+	for name, sub := range write.Groups {
+		g.Groups[name] = mergeWriteSet(current.Groups[name], sub)
+	}
+	return g
+}
+
+// decodedWriteSet decodes the write set of a config update envelope to JSON.
+func decodedWriteSet(tx []byte) (map[string]interface{}, error) {
+	data, err := resource.InspectChannelCreateTx(tx)
+	if err != nil {
+		return nil, err
+	}
+	var env map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &env); err != nil {
+		return nil, err
+	}
+	ws := jsonField(jsonField(jsonField(jsonField(env, "payload"), "data"), "config_update"), "write_set")
+	if ws == nil {
+		return nil, fmt.Errorf("config update has no write set")
+	}
+	return ws, nil
+}
+
+func jsonField(m map[string]interface{}, key string) map[string]interface{} {
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+// rawJSON encodes a part of a decoded config, nil if it is missing.
+func rawJSON(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func readSetElements(path string, g *common.ConfigGroup, elems *[]configSetElement) {
+	if g == nil {
+		return
+	}
+	*elems = append(*elems, configSetElement{Path: "[Group] " + path, Version: g.Version, ModPolicy: g.ModPolicy})
+	for _, name := range sortedKeys(g.Values) {
+		v := g.Values[name]
+		*elems = append(*elems, configSetElement{Path: "[Value] " + path + "/" + name, Version: v.Version, ModPolicy: v.ModPolicy})
+	}
+	for _, name := range sortedKeys(g.Policies) {
+		cp := g.Policies[name]
+		*elems = append(*elems, configSetElement{Path: "[Policy] " + path + "/" + name, Version: cp.Version, ModPolicy: cp.ModPolicy})
+	}
+	for _, name := range sortedKeys(g.Groups) {
+		readSetElements(path+"/"+name, g.Groups[name], elems)
+	}
+}
+
+// writeSetElements lists what the write set of a group changes in current, with the decoded old and
+// new elements. Elements written at their current version are only there to scope the update and
+// are left out.
+func writeSetElements(path string, current, write *common.ConfigGroup, old, written map[string]interface{}, elems *[]configSetElement) {
+	if current == nil {
+		*elems = append(*elems, configSetElement{Path: "[Group] " + path, Action: "added", Version: write.Version, ModPolicy: write.ModPolicy, New: rawJSON(written)})
+		return
+	}
+	rewritten := write.Version != current.Version
+	if rewritten {
+		*elems = append(*elems, configSetElement{Path: "[Group] " + path, Action: "modified", Version: write.Version, ModPolicy: write.ModPolicy})
+	}
+
+	oldValues, newValues := jsonField(old, "values"), jsonField(written, "values")
+	for _, name := range unionKeys(sortedKeys(current.Values), sortedKeys(write.Values)) {
+		cur, v := current.Values[name], write.Values[name]
+		e := configSetElement{Path: "[Value] " + path + "/" + name}
+		switch {
+		case v == nil && rewritten:
+			e.Action, e.Version, e.ModPolicy = "removed", cur.Version, cur.ModPolicy
+		case v == nil || (cur != nil && cur.Version == v.Version):
+			continue
+		case cur == nil:
+			e.Action, e.Version, e.ModPolicy = "added", v.Version, v.ModPolicy
+		default:
+			e.Action, e.Version, e.ModPolicy = "modified", v.Version, v.ModPolicy
+		}
+		if cur != nil {
+			e.Old = rawJSON(jsonField(oldValues, name)["value"])
+		}
+		if v != nil {
+			e.New = rawJSON(jsonField(newValues, name)["value"])
+		}
+		*elems = append(*elems, e)
+	}
+
+	oldPolicies, newPolicies := jsonField(old, "policies"), jsonField(written, "policies")
+	for _, name := range unionKeys(sortedKeys(current.Policies), sortedKeys(write.Policies)) {
+		cur, cp := current.Policies[name], write.Policies[name]
+		e := configSetElement{Path: "[Policy] " + path + "/" + name}
+		switch {
+		case cp == nil && rewritten:
+			e.Action, e.Version, e.ModPolicy = "removed", cur.Version, cur.ModPolicy
+		case cp == nil || (cur != nil && cur.Version == cp.Version):
+			continue
+		case cur == nil:
+			e.Action, e.Version, e.ModPolicy = "added", cp.Version, cp.ModPolicy
+		default:
+			e.Action, e.Version, e.ModPolicy = "modified", cp.Version, cp.ModPolicy
+		}
+		if cur != nil {
+			e.Old = rawJSON(jsonField(oldPolicies, name)["policy"])
+		}
+		if cp != nil {
+			e.New = rawJSON(jsonField(newPolicies, name)["policy"])
+		}
+		*elems = append(*elems, e)
+	}
+
+	oldGroups, newGroups := jsonField(old, "groups"), jsonField(written, "groups")
+	for _, name := range unionKeys(sortedKeys(current.Groups), sortedKeys(write.Groups)) {
+		cur, sub := current.Groups[name], write.Groups[name]
+		switch {
+		case sub != nil:
+			writeSetElements(path+"/"+name, cur, sub, jsonField(oldGroups, name), jsonField(newGroups, name), elems)
+		case rewritten:
+			*elems = append(*elems, configSetElement{Path: "[Group] " + path + "/" + name, Action: "removed", Version: cur.Version, ModPolicy: cur.ModPolicy, Old: rawJSON(jsonField(oldGroups, name))})
+		}
+	}
+}
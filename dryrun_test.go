@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+func testValue(version uint64, value string) *common.ConfigValue {
+	return &common.ConfigValue{Version: version, Value: []byte(value), ModPolicy: adminsPolicyKey}
+}
+
+func testPolicy(version uint64) *common.ConfigPolicy {
+	return &common.ConfigPolicy{Version: version, Policy: &common.Policy{Type: int32(common.Policy_IMPLICIT_META)}, ModPolicy: adminsPolicyKey}
+}
+
+func testGroup(version uint64, values map[string]*common.ConfigValue, policies map[string]*common.ConfigPolicy, groups map[string]*common.ConfigGroup) *common.ConfigGroup {
+	return &common.ConfigGroup{Version: version, Values: values, Policies: policies, Groups: groups, ModPolicy: adminsPolicyKey}
+}
+
+// testCurrentConfig is the config the write sets of the tests below are applied to.
+func testCurrentConfig() *common.ConfigGroup {
+	return testGroup(0,
+		map[string]*common.ConfigValue{"A": testValue(0, "a"), "B": testValue(0, "b")},
+		map[string]*common.ConfigPolicy{"Admins": testPolicy(0)},
+		map[string]*common.ConfigGroup{
+			"Application": testGroup(1,
+				map[string]*common.ConfigValue{"X": testValue(2, "x")},
+				nil,
+				map[string]*common.ConfigGroup{
+					"Org1": testGroup(0, map[string]*common.ConfigValue{"MSP": testValue(0, "org1")}, nil, nil),
+					"Org2": testGroup(0, map[string]*common.ConfigValue{"MSP": testValue(0, "org2")}, nil, nil),
+				}),
+		})
+}
+
+// flattenGroup lists the elements of a group as "kind path version value".
+func flattenGroup(path string, g *common.ConfigGroup, out *[]string) {
+	*out = append(*out, "[Group] "+path+" "+fmt.Sprint(g.Version))
+	for name, v := range g.Values {
+		*out = append(*out, "[Value] "+path+"/"+name+" "+fmt.Sprint(v.Version)+" "+string(v.Value))
+	}
+	for name, p := range g.Policies {
+		*out = append(*out, "[Policy] "+path+"/"+name+" "+fmt.Sprint(p.Version))
+	}
+	for name, sub := range g.Groups {
+		flattenGroup(path+"/"+name, sub, out)
+	}
+}
+
+func flatten(g *common.ConfigGroup) []string {
+	var out []string
+	flattenGroup("/Channel", g, &out)
+	sort.Strings(out)
+	return out
+}
+
+// writeSetTests are write sets over testCurrentConfig, with the config that results from them and
+// what writeSetElements reports they change.
+var writeSetTests = []struct {
+	name     string
+	write    *common.ConfigGroup
+	want     []string
+	elements []string
+}{
+	{
+		name:  "value modified",
+		write: testGroup(0, map[string]*common.ConfigValue{"A": testValue(1, "a2")}, nil, nil),
+		want: []string{
+			"[Group] /Channel 0", "[Group] /Channel/Application 1", "[Group] /Channel/Application/Org1 0", "[Group] /Channel/Application/Org2 0",
+			"[Policy] /Channel/Admins 0", "[Value] /Channel/A 1 a2", "[Value] /Channel/Application/Org1/MSP 0 org1",
+			"[Value] /Channel/Application/Org2/MSP 0 org2", "[Value] /Channel/Application/X 2 x", "[Value] /Channel/B 0 b",
+		},
+		elements: []string{"[Value] /Channel/A modified 1"},
+	},
+	{
+		name: "elements at their current version are left out",
+		write: testGroup(0,
+			map[string]*common.ConfigValue{"A": testValue(0, "ignored")},
+			map[string]*common.ConfigPolicy{"Admins": testPolicy(0)},
+			map[string]*common.ConfigGroup{"Application": testGroup(1, nil, nil, nil)}),
+		want: []string{
+			"[Group] /Channel 0", "[Group] /Channel/Application 1", "[Group] /Channel/Application/Org1 0", "[Group] /Channel/Application/Org2 0",
+			"[Policy] /Channel/Admins 0", "[Value] /Channel/A 0 a", "[Value] /Channel/Application/Org1/MSP 0 org1",
+			"[Value] /Channel/Application/Org2/MSP 0 org2", "[Value] /Channel/Application/X 2 x", "[Value] /Channel/B 0 b",
+		},
+		elements: nil,
+	},
+	{
+		name: "value and policy added, value removed by rewriting the group",
+		write: testGroup(1,
+			map[string]*common.ConfigValue{"A": testValue(0, "a"), "C": testValue(0, "c")},
+			map[string]*common.ConfigPolicy{"Admins": testPolicy(0), "Readers": testPolicy(0)},
+			map[string]*common.ConfigGroup{"Application": testGroup(1, nil, nil, nil)}),
+		want: []string{
+			"[Group] /Channel 1", "[Group] /Channel/Application 1", "[Group] /Channel/Application/Org1 0", "[Group] /Channel/Application/Org2 0",
+			"[Policy] /Channel/Admins 0", "[Policy] /Channel/Readers 0", "[Value] /Channel/A 0 a",
+			"[Value] /Channel/Application/Org1/MSP 0 org1", "[Value] /Channel/Application/Org2/MSP 0 org2",
+			"[Value] /Channel/Application/X 2 x", "[Value] /Channel/C 0 c",
+		},
+		elements: []string{"[Group] /Channel modified 1", "[Value] /Channel/B removed 0", "[Value] /Channel/C added 0", "[Policy] /Channel/Readers added 0"},
+	},
+	{
+		name: "policy removed by rewriting the group",
+		write: testGroup(1,
+			map[string]*common.ConfigValue{"A": testValue(0, "a"), "B": testValue(0, "b")},
+			nil,
+			map[string]*common.ConfigGroup{"Application": testGroup(1, nil, nil, nil)}),
+		want: []string{
+			"[Group] /Channel 1", "[Group] /Channel/Application 1", "[Group] /Channel/Application/Org1 0", "[Group] /Channel/Application/Org2 0",
+			"[Value] /Channel/A 0 a", "[Value] /Channel/Application/Org1/MSP 0 org1", "[Value] /Channel/Application/Org2/MSP 0 org2",
+			"[Value] /Channel/Application/X 2 x", "[Value] /Channel/B 0 b",
+		},
+		elements: []string{"[Group] /Channel modified 1", "[Policy] /Channel/Admins removed 0"},
+	},
+	{
+		name: "group added and group removed by rewriting the parent",
+		write: testGroup(0, nil, nil, map[string]*common.ConfigGroup{
+			"Application": testGroup(2,
+				map[string]*common.ConfigValue{"X": testValue(2, "x")},
+				nil,
+				map[string]*common.ConfigGroup{
+					"Org1": testGroup(0, nil, nil, nil),
+					"Org3": testGroup(0, map[string]*common.ConfigValue{"MSP": testValue(0, "org3")}, nil, nil),
+				}),
+		}),
+		want: []string{
+			"[Group] /Channel 0", "[Group] /Channel/Application 2", "[Group] /Channel/Application/Org1 0", "[Group] /Channel/Application/Org3 0",
+			"[Policy] /Channel/Admins 0", "[Value] /Channel/A 0 a", "[Value] /Channel/Application/Org1/MSP 0 org1",
+			"[Value] /Channel/Application/Org3/MSP 0 org3", "[Value] /Channel/Application/X 2 x", "[Value] /Channel/B 0 b",
+		},
+		elements: []string{"[Group] /Channel/Application modified 2", "[Group] /Channel/Application/Org2 removed 0", "[Group] /Channel/Application/Org3 added 0"},
+	},
+	{
+		name: "members of a group at its current version are kept",
+		write: testGroup(0, nil, nil, map[string]*common.ConfigGroup{
+			"Application": testGroup(1, nil, nil, map[string]*common.ConfigGroup{
+				"Org2": testGroup(0, map[string]*common.ConfigValue{"MSP": testValue(1, "org2 v1")}, nil, nil),
+			}),
+		}),
+		want: []string{
+			"[Group] /Channel 0", "[Group] /Channel/Application 1", "[Group] /Channel/Application/Org1 0", "[Group] /Channel/Application/Org2 0",
+			"[Policy] /Channel/Admins 0", "[Value] /Channel/A 0 a", "[Value] /Channel/Application/Org1/MSP 0 org1",
+			"[Value] /Channel/Application/Org2/MSP 1 org2 v1", "[Value] /Channel/Application/X 2 x", "[Value] /Channel/B 0 b",
+		},
+		elements: []string{"[Value] /Channel/Application/Org2/MSP modified 1"},
+	},
+}
+
+func TestMergeWriteSet(t *testing.T) {
+	for _, tt := range writeSetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := testCurrentConfig()
+			before := proto.Clone(current)
+			got := flatten(mergeWriteSet(current, tt.write))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeWriteSet() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if !proto.Equal(before, current) {
+				t.Error("mergeWriteSet() changed the current config")
+			}
+		})
+	}
+	current := testCurrentConfig()
+	if got := mergeWriteSet(current, nil); got != current {
+		t.Error("mergeWriteSet() of no write set should return the current group")
+	}
+}
+
+func TestWriteSetElements(t *testing.T) {
+	for _, tt := range writeSetTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var elems []configSetElement
+			writeSetElements("/Channel", testCurrentConfig(), tt.write, nil, nil, &elems)
+			var got []string
+			for _, e := range elems {
+				got = append(got, e.Path+" "+e.Action+" "+fmt.Sprint(e.Version))
+			}
+			if !reflect.DeepEqual(got, tt.elements) {
+				t.Errorf("writeSetElements() =\n%q\nwant\n%q", got, tt.elements)
+			}
+		})
+	}
+}
+
+func TestWriteSetElementsDecoded(t *testing.T) {
+	current := testGroup(0, map[string]*common.ConfigValue{"A": testValue(0, "a")}, nil, nil)
+	write := testGroup(0, map[string]*common.ConfigValue{"A": testValue(1, "a2")}, nil, nil)
+	old := map[string]interface{}{"values": map[string]interface{}{"A": map[string]interface{}{"value": "old"}}}
+	written := map[string]interface{}{"values": map[string]interface{}{"A": map[string]interface{}{"value": "new"}}}
+
+	var elems []configSetElement
+	writeSetElements("/Channel", current, write, old, written, &elems)
+	if len(elems) != 1 {
+		t.Fatalf("writeSetElements() = %d elements, want 1", len(elems))
+	}
+	if string(elems[0].Old) != `"old"` || string(elems[0].New) != `"new"` {
+		t.Errorf("writeSetElements() old %s new %s, want \"old\" and \"new\"", elems[0].Old, elems[0].New)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/hyperledger/simple-fabric-gateway
 go 1.15
 
 require (
+	github.com/Hyperledger-TWGC/ccs-gm v0.1.1
 	github.com/cloudflare/cfssl v1.5.0 // indirect
 	github.com/golang/protobuf v1.5.0
 	github.com/hyperledger/fabric-protos-go v0.0.0-20200707132912-fee30f3ccd23
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	gmx509 "github.com/Hyperledger-TWGC/ccs-gm/x509"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/hyperledger/fabric-protos-go/orderer/etcdraft"
+	"github.com/hyperledger/fabric-protos-go/orderer/ybft"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+)
+
+// blocks are cut at AbsoluteMaxBytes, which is 99 MB in the sample configtx.yaml
+const maxArtifactUploadSize = 100 << 20
+
+// config group and value keys, as in fabric's common/channelconfig
+const (
+	ordererGroupKey     = "Orderer"
+	applicationGroupKey = "Application"
+	consortiumsGroupKey = "Consortiums"
+
+	mspKey              = "MSP"
+	capabilitiesKey     = "Capabilities"
+	anchorPeersKey      = "AnchorPeers"
+	endpointsKey        = "Endpoints"
+	ordererAddressesKey = "OrdererAddresses"
+	consensusTypeKey    = "ConsensusType"
+	batchSizeKey        = "BatchSize"
+	batchTimeoutKey     = "BatchTimeout"
+	consortiumKey       = "Consortium"
+	aclsKey             = "ACLs"
+
+	adminsPolicyKey = "Admins"
+)
+
+// inspectResult is an artifact decoded like configtxlator proto_decode does, with the parts worth
+// auditing pulled out of the tree.
+type inspectResult struct {
+	Decoded json.RawMessage `json:"decoded"`
+	Summary *configSummary  `json:"summary,omitempty"`
+}
+
+type configSummary struct {
+	ChannelID    string              `json:"channelID"`
+	BlockNumber  *uint64             `json:"blockNumber,omitempty"`
+	Consortium   string              `json:"consortium,omitempty"`
+	Signatures   int                 `json:"signatures,omitempty"`
+	Capabilities map[string][]string `json:"capabilities"` // by group path
+	Policies     []policySummary     `json:"policies"`
+	Orgs         []orgSummary        `json:"orgs"`
+	Orderer      *ordererSummary     `json:"orderer,omitempty"`
+	Consortiums  []string            `json:"consortiums,omitempty"`
+}
+
+type policySummary struct {
+	Path      string `json:"path"`
+	Type      string `json:"type"`
+	Rule      string `json:"rule"`
+	ModPolicy string `json:"modPolicy,omitempty"`
+}
+
+type orgSummary struct {
+	Path              string        `json:"path"`
+	MSPID             string        `json:"mspID"`
+	RootCerts         []certSummary `json:"rootCerts"`
+	IntermediateCerts []certSummary `json:"intermediateCerts,omitempty"`
+	TLSRootCerts      []certSummary `json:"tlsRootCerts,omitempty"`
+	NodeOUs           bool          `json:"nodeOUs"`
+	AnchorPeers       []string      `json:"anchorPeers,omitempty"`
+	OrdererEndpoints  []string      `json:"ordererEndpoints,omitempty"`
+}
+
+type certSummary struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	Expired   bool      `json:"expired"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type ordererSummary struct {
+	ConsensusType  string             `json:"consensusType"`
+	State          string             `json:"state,omitempty"`
+	Addresses      []string           `json:"addresses,omitempty"`
+	BatchTimeout   string             `json:"batchTimeout,omitempty"`
+	BatchSize      *batchRequest      `json:"batchSize,omitempty"`
+	Consenters     []consenterSummary `json:"consenters,omitempty"`
+	ConsensusError string             `json:"consensusError,omitempty"`
+}
+
+type consenterSummary struct {
+	Host          string       `json:"host"`
+	Port          uint32       `json:"port"`
+	MSPID         string       `json:"mspID,omitempty"`
+	ClientTLSCert *certSummary `json:"clientTLSCert,omitempty"`
+	ServerTLSCert *certSummary `json:"serverTLSCert,omitempty"`
+}
+
+// readArtifactUpload reads the artifact sent as the named file of a multipart form, or as the raw request body.
+// ?id= references an artifact in the artifact store instead.
+func readArtifactUpload(w http.ResponseWriter, r *http.Request, field string) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, &apiError{Status: http.StatusMethodNotAllowed, Message: fmt.Sprintf("method %s not allowed", r.Method)}
+	}
+	if id := r.URL.Query().Get("id"); id != "" {
+		return artifacts.get(id)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxArtifactUploadSize)
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, badRequest("invalid request body: %v", err)
+		}
+		if len(data) == 0 {
+			return nil, badRequest("invalid request: %s is required", field)
+		}
+		return data, nil
+	}
+	if err := r.ParseMultipartForm(maxArtifactUploadSize); err != nil {
+		return nil, badRequest("invalid multipart form: %v", err)
+	}
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File[field]
+	if len(files) == 0 {
+		return nil, badRequest("invalid request: %s is required", field)
+	}
+	data, err := readFormFile(files[0])
+	if err != nil {
+		return nil, badRequest("invalid multipart form: %s: %v", field, err)
+	}
+	return data, nil
+}
+
+func inspectBlock(w http.ResponseWriter, r *http.Request) {
+	data, err := readArtifactUpload(w, r, "block")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doInspectBlock(data)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doInspectBlock(data []byte) (*inspectResult, error) {
+	decoded, err := resource.InspectBlock(data)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	result := &inspectResult{Decoded: json.RawMessage(decoded)}
+	block := &common.Block{}
+	if err := proto.Unmarshal(data, block); err != nil {
+		return nil, badRequest("error unmarshaling block: %v", err)
+	}
+	// only config blocks carry a channel config
+	channelID, env, err := blockConfigEnvelope(block)
+	if err != nil {
+		return result, nil
+	}
+	result.Summary = summarizeConfig(env.Config.GetChannelGroup())
+	result.Summary.ChannelID = channelID
+	number := block.GetHeader().GetNumber()
+	result.Summary.BlockNumber = &number
+	return result, nil
+}
+
+func inspectChannelCreateTx(w http.ResponseWriter, r *http.Request) {
+	data, err := readArtifactUpload(w, r, "tx")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doInspectChannelCreateTx(data)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doInspectChannelCreateTx(data []byte) (*inspectResult, error) {
+	decoded, err := resource.InspectChannelCreateTx(data)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	result := &inspectResult{Decoded: json.RawMessage(decoded)}
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(data, env); err != nil {
+		return nil, badRequest("error unmarshaling envelope: %v", err)
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return nil, badRequest("error unmarshaling payload: %v", err)
+	}
+	cue := &common.ConfigUpdateEnvelope{}
+	if err := proto.Unmarshal(payload.Data, cue); err != nil {
+		return nil, badRequest("envelope is not a config update: %v", err)
+	}
+	cu := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(cue.ConfigUpdate, cu); err != nil {
+		return nil, badRequest("error unmarshaling config update: %v", err)
+	}
+	result.Summary = summarizeConfig(cu.WriteSet)
+	result.Summary.ChannelID = cu.ChannelId
+	result.Summary.Signatures = len(cue.Signatures)
+	return result, nil
+}
+
+// blockConfigEnvelope returns the channel ID and the config of a config block.
+func blockConfigEnvelope(block *common.Block) (string, *common.ConfigEnvelope, error) {
+	if len(block.GetData().GetData()) == 0 {
+		return "", nil, fmt.Errorf("block has no data")
+	}
+	env := &common.Envelope{}
+	if err := proto.Unmarshal(block.Data.Data[0], env); err != nil {
+		return "", nil, err
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return "", nil, err
+	}
+	chdr := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), chdr); err != nil {
+		return "", nil, err
+	}
+	if common.HeaderType(chdr.Type) != common.HeaderType_CONFIG {
+		return "", nil, fmt.Errorf("block %d is not a config block", block.GetHeader().GetNumber())
+	}
+	configEnv := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnv); err != nil {
+		return "", nil, err
+	}
+	return chdr.ChannelId, configEnv, nil
+}
+
+// summarizeConfig walks a channel config group, or the write set of a config update.
+func summarizeConfig(root *common.ConfigGroup) *configSummary {
+	s := &configSummary{Capabilities: make(map[string][]string), Policies: []policySummary{}, Orgs: []orgSummary{}}
+	if root == nil {
+		return s
+	}
+	if v, ok := root.Values[consortiumKey]; ok {
+		c := &common.Consortium{}
+		if proto.Unmarshal(v.Value, c) == nil {
+			s.Consortium = c.Name
+		}
+	}
+	s.walk("/Channel", root)
+	if og, ok := root.Groups[ordererGroupKey]; ok {
+		s.Orderer = summarizeOrderer(root, og)
+	}
+	if cg, ok := root.Groups[consortiumsGroupKey]; ok {
+		for name := range cg.Groups {
+			s.Consortiums = append(s.Consortiums, name)
+		}
+		sort.Strings(s.Consortiums)
+	}
+	return s
+}
+
+func (s *configSummary) walk(path string, group *common.ConfigGroup) {
+	if v, ok := group.Values[capabilitiesKey]; ok {
+		caps := &common.Capabilities{}
+		if proto.Unmarshal(v.Value, caps) == nil {
+			names := make([]string, 0, len(caps.Capabilities))
+			for name := range caps.Capabilities {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			s.Capabilities[path] = names
+		}
+	}
+	for _, name := range sortedKeys(group.Policies) {
+		cp := group.Policies[name]
+		ps := policySummary{Path: path + "/" + name, ModPolicy: cp.ModPolicy}
+		ps.Type, ps.Rule = policyRule(cp.Policy)
+		s.Policies = append(s.Policies, ps)
+	}
+	if v, ok := group.Values[mspKey]; ok {
+		s.Orgs = append(s.Orgs, summarizeOrg(path, group, v))
+	}
+	for _, name := range sortedKeys(group.Groups) {
+		s.walk(path+"/"+name, group.Groups[name])
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*common.ConfigPolicy:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*common.ConfigGroup:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*common.ConfigValue:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// policyRule renders a config policy as in configtx.yaml, e.g. ImplicitMeta "MAJORITY Admins".
+func policyRule(p *common.Policy) (string, string) {
+	if p == nil {
+		return "", ""
+	}
+	switch common.Policy_PolicyType(p.Type) {
+	case common.Policy_SIGNATURE:
+		env := &common.SignaturePolicyEnvelope{}
+		if err := proto.Unmarshal(p.Value, env); err != nil {
+			return "Signature", "<invalid signature policy>"
+		}
+		return "Signature", signaturePolicyString(env)
+	case common.Policy_IMPLICIT_META:
+		imp := &common.ImplicitMetaPolicy{}
+		if err := proto.Unmarshal(p.Value, imp); err != nil {
+			return "ImplicitMeta", "<invalid implicit meta policy>"
+		}
+		return "ImplicitMeta", imp.Rule.String() + " " + imp.SubPolicy
+	}
+	return common.Policy_PolicyType(p.Type).String(), ""
+}
+
+func summarizeOrg(path string, group *common.ConfigGroup, v *common.ConfigValue) orgSummary {
+	org := orgSummary{Path: path, RootCerts: []certSummary{}}
+	mspConfig := &mspproto.MSPConfig{}
+	fabricConfig := &mspproto.FabricMSPConfig{}
+	if proto.Unmarshal(v.Value, mspConfig) == nil && proto.Unmarshal(mspConfig.Config, fabricConfig) == nil {
+		org.MSPID = fabricConfig.Name
+		org.RootCerts = certSummaries(fabricConfig.RootCerts)
+		org.IntermediateCerts = certSummaries(fabricConfig.IntermediateCerts)
+		org.TLSRootCerts = certSummaries(fabricConfig.TlsRootCerts)
+		org.NodeOUs = fabricConfig.GetFabricNodeOus().GetEnable()
+	}
+	if v, ok := group.Values[anchorPeersKey]; ok {
+		aps := &pb.AnchorPeers{}
+		if proto.Unmarshal(v.Value, aps) == nil {
+			for _, ap := range aps.AnchorPeers {
+				org.AnchorPeers = append(org.AnchorPeers, fmt.Sprintf("%s:%d", ap.Host, ap.Port))
+			}
+		}
+	}
+	if v, ok := group.Values[endpointsKey]; ok {
+		addrs := &common.OrdererAddresses{}
+		if proto.Unmarshal(v.Value, addrs) == nil {
+			org.OrdererEndpoints = addrs.Addresses
+		}
+	}
+	return org
+}
+
+func summarizeOrderer(root, og *common.ConfigGroup) *ordererSummary {
+	o := &ordererSummary{}
+	if v, ok := root.Values[ordererAddressesKey]; ok {
+		addrs := &common.OrdererAddresses{}
+		if proto.Unmarshal(v.Value, addrs) == nil {
+			o.Addresses = addrs.Addresses
+		}
+	}
+	if v, ok := og.Values[batchTimeoutKey]; ok {
+		bt := &orderer.BatchTimeout{}
+		if proto.Unmarshal(v.Value, bt) == nil {
+			o.BatchTimeout = bt.Timeout
+		}
+	}
+	if v, ok := og.Values[batchSizeKey]; ok {
+		bs := &orderer.BatchSize{}
+		if proto.Unmarshal(v.Value, bs) == nil {
+			o.BatchSize = &batchRequest{
+				MaxMessageCount:   bs.MaxMessageCount,
+				AbsoluteMaxBytes:  bs.AbsoluteMaxBytes,
+				PreferredMaxBytes: bs.PreferredMaxBytes,
+			}
+		}
+	}
+	v, ok := og.Values[consensusTypeKey]
+	if !ok {
+		return o
+	}
+	ct := &orderer.ConsensusType{}
+	if err := proto.Unmarshal(v.Value, ct); err != nil {
+		o.ConsensusError = err.Error()
+		return o
+	}
+	o.ConsensusType = ct.Type
+	o.State = ct.State.String()
+	switch ct.Type {
+	case "etcdraft":
+		md := &etcdraft.ConfigMetadata{}
+		if err := proto.Unmarshal(ct.Metadata, md); err != nil {
+			o.ConsensusError = err.Error()
+			return o
+		}
+		for _, c := range md.Consenters {
+			o.Consenters = append(o.Consenters, consenterSummary{
+				Host:          c.Host,
+				Port:          c.Port,
+				ClientTLSCert: certSummaryOf(c.ClientTlsCert),
+				ServerTLSCert: certSummaryOf(c.ServerTlsCert),
+			})
+		}
+	case "PBFT":
+		md := &ybft.ConfigMetadata{}
+		if err := proto.Unmarshal(ct.Metadata, md); err != nil {
+			o.ConsensusError = err.Error()
+			return o
+		}
+		for _, c := range md.Consenters {
+			cs := consenterSummary{
+				Host:          c.Host,
+				Port:          c.Port,
+				ClientTLSCert: certSummaryOf(c.ClientTlsCert),
+				ServerTLSCert: certSummaryOf(c.ServerTlsCert),
+			}
+			sid := &mspproto.SerializedIdentity{}
+			if proto.Unmarshal(c.SerializedIdentity, sid) == nil {
+				cs.MSPID = sid.Mspid
+			}
+			o.Consenters = append(o.Consenters, cs)
+		}
+	}
+	return o
+}
+
+func certSummaries(pems [][]byte) []certSummary {
+	var certs []certSummary
+	for _, p := range pems {
+		if c := certSummaryOf(p); c != nil {
+			certs = append(certs, *c)
+		}
+	}
+	return certs
+}
+
+func certSummaryOf(data []byte) *certSummary {
+	if len(data) == 0 {
+		return nil
+	}
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	}
+	cert, err := parseCertificateInfo(der)
+	if err != nil {
+		return &certSummary{Error: err.Error()}
+	}
+	cert.Expired = time.Now().After(cert.NotAfter)
+	return cert
+}
+
+// parseCertificateInfo reads subject, issuer and validity. crypto/x509 rejects SM2 keys, so those
+// certificates are read with gmx509.
+func parseCertificateInfo(der []byte) (*certSummary, error) {
+	if cert, err := x509.ParseCertificate(der); err == nil {
+		return &certSummary{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+		}, nil
+	}
+	cert, err := gmx509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	return &certSummary{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}, nil
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	lcpackager "github.com/hyperledger/fabric-sdk-go/pkg/fab/ccpackager/lifecycle"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+const (
+	endorsementPlugin = "escc"
+	validationPlugin  = "vscc"
+)
+
+// chaincodeDefinition is what every org approves and what is finally committed to the channel.
+// All orgs have to approve exactly the same definition.
+type chaincodeDefinition struct {
+	endorsementPolicy
+	Name         string              `json:"name"`
+	Version      string              `json:"version"`
+	Sequence     int64               `json:"sequence,omitempty"`
+	Collections  []collectionRequest `json:"collections,omitempty"`
+	InitRequired bool                `json:"initRequired,omitempty"`
+
+	collections []*pb.CollectionConfig
+}
+
+func (d *chaincodeDefinition) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if d.Version == "" {
+		return fmt.Errorf("version is required")
+	}
+	if d.Sequence == 0 {
+		d.Sequence = defaultChaincodeSequence
+	}
+	if d.Sequence < 0 {
+		return fmt.Errorf("invalid sequence %d", d.Sequence)
+	}
+	if err := d.endorsementPolicy.validate(); err != nil {
+		return err
+	}
+	collections, err := collectionConfigs(d.Collections)
+	if err != nil {
+		return err
+	}
+	d.collections = collections
+	return nil
+}
+
+func (d *chaincodeDefinition) approveRequest(packageID string) resmgmt.LifecycleApproveCCRequest {
+	return resmgmt.LifecycleApproveCCRequest{
+		Name:                d.Name,
+		Version:             d.Version,
+		PackageID:           packageID,
+		Sequence:            d.Sequence,
+		EndorsementPlugin:   endorsementPlugin,
+		ValidationPlugin:    validationPlugin,
+		SignaturePolicy:     d.envelope(),
+		ChannelConfigPolicy: d.ChannelConfigPolicy,
+		CollectionConfig:    d.collections,
+		InitRequired:        d.InitRequired,
+	}
+}
+
+func (d *chaincodeDefinition) readinessRequest() resmgmt.LifecycleCheckCCCommitReadinessRequest {
+	return resmgmt.LifecycleCheckCCCommitReadinessRequest{
+		Name:                d.Name,
+		Version:             d.Version,
+		Sequence:            d.Sequence,
+		EndorsementPlugin:   endorsementPlugin,
+		ValidationPlugin:    validationPlugin,
+		SignaturePolicy:     d.envelope(),
+		ChannelConfigPolicy: d.ChannelConfigPolicy,
+		CollectionConfig:    d.collections,
+		InitRequired:        d.InitRequired,
+	}
+}
+
+func (d *chaincodeDefinition) commitRequest() resmgmt.LifecycleCommitCCRequest {
+	return resmgmt.LifecycleCommitCCRequest{
+		Name:                d.Name,
+		Version:             d.Version,
+		Sequence:            d.Sequence,
+		EndorsementPlugin:   endorsementPlugin,
+		ValidationPlugin:    validationPlugin,
+		SignaturePolicy:     d.envelope(),
+		ChannelConfigPolicy: d.ChannelConfigPolicy,
+		CollectionConfig:    d.collections,
+		InitRequired:        d.InitRequired,
+	}
+}
+
+func targetOpts(peers []string) []resmgmt.RequestOption {
+	var opts []resmgmt.RequestOption
+	if len(peers) > 0 {
+		opts = append(opts, resmgmt.WithTargetEndpoints(peers...))
+	}
+	return append(opts, resmgmt.WithRetry(retry.DefaultResMgmtOpts))
+}
+
+type installChaincodeRequest struct {
+	identityRequest
+	chaincodeSource
+	Label string   `json:"label"`
+	Peers []string `json:"peers,omitempty"`
+}
+
+func (r *installChaincodeRequest) validate() error {
+	r.setDefaults()
+	if r.Label == "" {
+		return fmt.Errorf("label is required")
+	}
+	return r.chaincodeSource.validate()
+}
+
+// approveChaincodeRequest approves a definition for the org of the requesting identity.
+// PackageID may be left empty by orgs that endorse but do not run the chaincode.
+type approveChaincodeRequest struct {
+	identityRequest
+	chaincodeDefinition
+	ChannelID string   `json:"channelID"`
+	PackageID string   `json:"packageID,omitempty"`
+	Peers     []string `json:"peers,omitempty"`
+	Orderer   string   `json:"orderer,omitempty"`
+}
+
+func (r *approveChaincodeRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if err := r.chaincodeDefinition.validate(); err != nil {
+		return err
+	}
+	if !r.isSet() {
+		return fmt.Errorf("one of endorsingMSPs, signaturePolicy or channelConfigPolicy is required")
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+// commitChaincodeRequest is the body of /chaincode/commit and /chaincode/checkcommitreadiness,
+// the latter ignores the orderer.
+type commitChaincodeRequest approveChaincodeRequest
+
+func (r *commitChaincodeRequest) validate() error {
+	if r.PackageID != "" {
+		return fmt.Errorf("packageID is only used by approve")
+	}
+	return (*approveChaincodeRequest)(r).validate()
+}
+
+type queryInstalledRequest struct {
+	identityRequest
+	Peers []string `json:"peers"`
+}
+
+func (r *queryInstalledRequest) validate() error {
+	r.setDefaults()
+	if len(r.Peers) == 0 {
+		return fmt.Errorf("peers is required")
+	}
+	return nil
+}
+
+type queryApprovedRequest struct {
+	identityRequest
+	ChannelID string   `json:"channelID"`
+	Name      string   `json:"name"`
+	Sequence  int64    `json:"sequence,omitempty"` // 0 queries the latest approved sequence
+	Peers     []string `json:"peers"`
+}
+
+func (r *queryApprovedRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Sequence < 0 {
+		return fmt.Errorf("invalid sequence %d", r.Sequence)
+	}
+	if len(r.Peers) == 0 {
+		return fmt.Errorf("peers is required")
+	}
+	return nil
+}
+
+type queryCommittedRequest struct {
+	identityRequest
+	ChannelID string   `json:"channelID"`
+	Name      string   `json:"name,omitempty"` // empty lists every committed chaincode
+	Peers     []string `json:"peers,omitempty"`
+}
+
+func (r *queryCommittedRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	return nil
+}
+
+type installChaincodeResult struct {
+	PackageID string                               `json:"packageID"`
+	Installed []resmgmt.LifecycleInstallCCResponse `json:"installed"` // peers that already had the package are left out
+}
+
+// chaincodeDefinitionResult is a queried definition with its policies decoded to the DSL form.
+type chaincodeDefinitionResult struct {
+	Name                string              `json:"name"`
+	Version             string              `json:"version"`
+	Sequence            int64               `json:"sequence"`
+	EndorsementPlugin   string              `json:"endorsementPlugin"`
+	ValidationPlugin    string              `json:"validationPlugin"`
+	SignaturePolicy     string              `json:"signaturePolicy,omitempty"`
+	ChannelConfigPolicy string              `json:"channelConfigPolicy,omitempty"`
+	Collections         []collectionRequest `json:"collections,omitempty"`
+	InitRequired        bool                `json:"initRequired"`
+	PackageID           string              `json:"packageID,omitempty"` // approved definitions only
+	Approvals           map[string]bool     `json:"approvals,omitempty"` // committed definitions only
+}
+
+func approvedDefinitionResult(d resmgmt.LifecycleApprovedChaincodeDefinition) chaincodeDefinitionResult {
+	return chaincodeDefinitionResult{
+		Name:                d.Name,
+		Version:             d.Version,
+		Sequence:            d.Sequence,
+		EndorsementPlugin:   d.EndorsementPlugin,
+		ValidationPlugin:    d.ValidationPlugin,
+		SignaturePolicy:     signaturePolicyString(d.SignaturePolicy),
+		ChannelConfigPolicy: d.ChannelConfigPolicy,
+		Collections:         collectionsFromConfigs(d.CollectionConfig),
+		InitRequired:        d.InitRequired,
+		PackageID:           d.PackageID,
+	}
+}
+
+func committedDefinitionResult(d resmgmt.LifecycleChaincodeDefinition) chaincodeDefinitionResult {
+	return chaincodeDefinitionResult{
+		Name:                d.Name,
+		Version:             d.Version,
+		Sequence:            d.Sequence,
+		EndorsementPlugin:   d.EndorsementPlugin,
+		ValidationPlugin:    d.ValidationPlugin,
+		SignaturePolicy:     signaturePolicyString(d.SignaturePolicy),
+		ChannelConfigPolicy: d.ChannelConfigPolicy,
+		Collections:         collectionsFromConfigs(d.CollectionConfig),
+		InitRequired:        d.InitRequired,
+		Approvals:           d.Approvals,
+	}
+}
+
+type approvalsResult struct {
+	Approvals map[string]bool `json:"approvals"`
+}
+
+func installChaincode(w http.ResponseWriter, r *http.Request) {
+	var req installChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doInstallChaincode(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func approveChaincode(w http.ResponseWriter, r *http.Request) {
+	var req approveChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	txID, result, err := doApproveChaincode(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{TxID: string(txID), Result: result})
+}
+
+func checkCommitReadiness(w http.ResponseWriter, r *http.Request) {
+	var req commitChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doCheckCommitReadiness(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func commitChaincode(w http.ResponseWriter, r *http.Request) {
+	var req commitChaincodeRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	txID, result, err := doCommitChaincode(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{TxID: string(txID), Result: result})
+}
+
+func queryInstalledChaincodes(w http.ResponseWriter, r *http.Request) {
+	var req queryInstalledRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doQueryInstalledChaincodes(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func queryApprovedChaincode(w http.ResponseWriter, r *http.Request) {
+	var req queryApprovedRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doQueryApprovedChaincode(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func queryCommittedChaincodes(w http.ResponseWriter, r *http.Request) {
+	var req queryCommittedRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doQueryCommittedChaincodes(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doInstallChaincode(profile sdkProfile, req *installChaincodeRequest) (result *installChaincodeResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client context: %v", err)
+	}
+	ccPkg, err := req.newPackage(req.Label)
+	if err != nil {
+		return nil, err
+	}
+	packageID := lcpackager.ComputePackageIDWithHashOpts(req.Label, ccPkg, cc.SigningManager().GetHashOpts())
+	resp, err := resMgmtClient.LifecycleInstallCC(resmgmt.LifecycleInstallCCRequest{Label: req.Label, Package: ccPkg}, targetOpts(req.Peers)...)
+	if err != nil {
+		return nil, err
+	}
+	return &installChaincodeResult{PackageID: packageID, Installed: resp}, nil
+}
+
+func doApproveChaincode(profile sdkProfile, req *approveChaincodeRequest) (txID fab.TransactionID, result *approvalsResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return "", nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return "", nil, err
+	}
+	txID, err = resMgmtClient.LifecycleApproveCC(req.ChannelID, req.approveRequest(req.PackageID), append(targetOpts(req.Peers), resmgmt.WithOrdererEndpoint(req.Orderer))...)
+	if err != nil {
+		return "", nil, err
+	}
+	// approve waits for the transaction to commit, so the readiness below already includes it
+	resp, err := resMgmtClient.LifecycleCheckCCCommitReadiness(req.ChannelID, req.readinessRequest(), targetOpts(req.Peers)...)
+	if err != nil {
+		return txID, nil, err
+	}
+	return txID, &approvalsResult{Approvals: resp.Approvals}, nil
+}
+
+func doCheckCommitReadiness(profile sdkProfile, req *commitChaincodeRequest) (result *approvalsResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := resMgmtClient.LifecycleCheckCCCommitReadiness(req.ChannelID, req.readinessRequest(), targetOpts(req.Peers)...)
+	if err != nil {
+		return nil, err
+	}
+	return &approvalsResult{Approvals: resp.Approvals}, nil
+}
+
+func doCommitChaincode(profile sdkProfile, req *commitChaincodeRequest) (txID fab.TransactionID, result *approvalsResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return "", nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return "", nil, err
+	}
+	txID, err = resMgmtClient.LifecycleCommitCC(req.ChannelID, req.commitRequest(), append(targetOpts(req.Peers), resmgmt.WithOrdererEndpoint(req.Orderer))...)
+	if err != nil {
+		return "", nil, err
+	}
+	committed, err := resMgmtClient.LifecycleQueryCommittedCC(req.ChannelID, resmgmt.LifecycleQueryCommittedCCRequest{Name: req.Name}, targetOpts(req.Peers)...)
+	if err != nil {
+		return txID, nil, err
+	}
+	if len(committed) == 0 {
+		return txID, nil, fmt.Errorf("chaincode %s is not found on channel %s after commit", req.Name, req.ChannelID)
+	}
+	return txID, &approvalsResult{Approvals: committed[0].Approvals}, nil
+}
+
+// doQueryInstalledChaincodes queries every peer on its own, the lifecycle query only takes one target.
+func doQueryInstalledChaincodes(profile sdkProfile, req *queryInstalledRequest) (result map[string][]resmgmt.LifecycleInstalledCC, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	result = make(map[string][]resmgmt.LifecycleInstalledCC, len(req.Peers))
+	for _, peer := range req.Peers {
+		installed, err := resMgmtClient.LifecycleQueryInstalledCC(targetOpts([]string{peer})...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query installed chaincodes on %s: %v", peer, err)
+		}
+		result[peer] = installed
+	}
+	return result, nil
+}
+
+func doQueryApprovedChaincode(profile sdkProfile, req *queryApprovedRequest) (result map[string]chaincodeDefinitionResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	result = make(map[string]chaincodeDefinitionResult, len(req.Peers))
+	for _, peer := range req.Peers {
+		approved, err := resMgmtClient.LifecycleQueryApprovedCC(req.ChannelID, resmgmt.LifecycleQueryApprovedCCRequest{Name: req.Name, Sequence: req.Sequence}, targetOpts([]string{peer})...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query approved chaincode on %s: %v", peer, err)
+		}
+		result[peer] = approvedDefinitionResult(approved)
+	}
+	return result, nil
+}
+
+func doQueryCommittedChaincodes(profile sdkProfile, req *queryCommittedRequest) (result []chaincodeDefinitionResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	resMgmtClient, err := sdk.resmgmtClient(req.Org, req.User)
+	if err != nil {
+		return nil, err
+	}
+	committed, err := resMgmtClient.LifecycleQueryCommittedCC(req.ChannelID, resmgmt.LifecycleQueryCommittedCCRequest{Name: req.Name}, targetOpts(req.Peers)...)
+	if err != nil {
+		return nil, err
+	}
+	result = []chaincodeDefinitionResult{}
+	for _, d := range committed {
+		result = append(result, committedDefinitionResult(d))
+	}
+	return result, nil
+}
@@ -1,28 +1,99 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/network/genesisblock", createGenesisBlock)
 	mux.HandleFunc("/network/channelcreatetx", createChannelCreateTx)
+	mux.HandleFunc("/network/inspectblock", inspectBlock)
+	mux.HandleFunc("/network/inspectchannelcreatetx", inspectChannelCreateTx)
+	mux.HandleFunc("/network/cryptogen", generateCrypto)
+	mux.HandleFunc("/network/orderers", updateOrdererMembership)
+	mux.HandleFunc("/network/capabilities", capabilities)
+	mux.HandleFunc("/artifact", getArtifact)
+	mux.HandleFunc("/channel/create", createChannel)
 	mux.HandleFunc("/channel/setup", setupChannel)
 	mux.HandleFunc("/channel/updateanchorpeers", updateAnchorPeers)
+	mux.HandleFunc("/channel/proposal", getProposal)
+	mux.HandleFunc("/channel/proposal/create", createProposal)
+	mux.HandleFunc("/channel/proposal/sign", signProposal)
+	mux.HandleFunc("/channel/signconfigupdate", signConfigUpdateHandler)
+	mux.HandleFunc("/channel/", channelResource)
 	mux.HandleFunc("/chaincode/deploy", deployChaincode)
+	mux.HandleFunc("/chaincode/upgrade", upgradeChaincode)
+	mux.HandleFunc("/chaincode/install", installChaincode)
+	mux.HandleFunc("/chaincode/upload", uploadChaincode)
+	mux.HandleFunc("/chaincode/packageid", computePackageID)
+	mux.HandleFunc("/chaincode/approve", approveChaincode)
+	mux.HandleFunc("/chaincode/checkcommitreadiness", checkCommitReadiness)
+	mux.HandleFunc("/chaincode/commit", commitChaincode)
+	mux.HandleFunc("/chaincode/queryinstalled", queryInstalledChaincodes)
+	mux.HandleFunc("/chaincode/queryapproved", queryApprovedChaincode)
+	mux.HandleFunc("/chaincode/querycommitted", queryCommittedChaincodes)
+	mux.HandleFunc("/chaincode/collections", queryCollections)
 	mux.HandleFunc("/chaincode/invoke", invokeChaincode)
+	mux.HandleFunc("/chaincode/query", queryChaincode)
 
 	mux.HandleFunc("/gm/network/genesisblock", createGenesisBlock)
 	mux.HandleFunc("/gm/network/channelcreatetx", createChannelCreateTx)
+	mux.HandleFunc("/gm/network/inspectblock", inspectBlock)
+	mux.HandleFunc("/gm/network/inspectchannelcreatetx", inspectChannelCreateTx)
+	mux.HandleFunc("/gm/network/cryptogen", generateCrypto)
+	mux.HandleFunc("/gm/network/orderers", updateOrdererMembership)
+	mux.HandleFunc("/gm/network/capabilities", capabilities)
+	mux.HandleFunc("/gm/artifact", getArtifact)
+	mux.HandleFunc("/gm/channel/create", createChannel)
 	mux.HandleFunc("/gm/channel/setup", setupChannel)
 	mux.HandleFunc("/gm/channel/updateanchorpeers", updateAnchorPeers)
+	mux.HandleFunc("/gm/channel/proposal", getProposal)
+	mux.HandleFunc("/gm/channel/proposal/create", createProposal)
+	mux.HandleFunc("/gm/channel/proposal/sign", signProposal)
+	mux.HandleFunc("/gm/channel/signconfigupdate", signConfigUpdateHandler)
+	mux.HandleFunc("/gm/channel/", channelResource)
 	mux.HandleFunc("/gm/chaincode/deploy", deployChaincode)
+	mux.HandleFunc("/gm/chaincode/upgrade", upgradeChaincode)
+	mux.HandleFunc("/gm/chaincode/install", installChaincode)
+	mux.HandleFunc("/gm/chaincode/upload", uploadChaincode)
+	mux.HandleFunc("/gm/chaincode/packageid", computePackageID)
+	mux.HandleFunc("/gm/chaincode/approve", approveChaincode)
+	mux.HandleFunc("/gm/chaincode/checkcommitreadiness", checkCommitReadiness)
+	mux.HandleFunc("/gm/chaincode/commit", commitChaincode)
+	mux.HandleFunc("/gm/chaincode/queryinstalled", queryInstalledChaincodes)
+	mux.HandleFunc("/gm/chaincode/queryapproved", queryApprovedChaincode)
+	mux.HandleFunc("/gm/chaincode/querycommitted", queryCommittedChaincodes)
+	mux.HandleFunc("/gm/chaincode/collections", queryCollections)
 	mux.HandleFunc("/gm/chaincode/invoke", invokeChaincode)
+	mux.HandleFunc("/gm/chaincode/query", queryChaincode)
 
 	// mux.HandleFunc("/channel/config", getFabricCryptoConfig)
 
-	log.Fatal(http.ListenAndServe(":12345", mux))
+	srv := &http.Server{Addr: ":12345", Handler: mux}
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println(err.Error())
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	// in-flight requests are drained, release the pooled sdks and their connections
+	sdks.close()
 }
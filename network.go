@@ -2,16 +2,11 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource/genesisconfig"
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
@@ -21,250 +16,330 @@ const (
 	configFilePath   = "./config.yaml"
 	gmConfigFilePath = "./config-gm.yaml"
 
-	systemChannelName   = "system-channel"
-	genesisBlockProfile = "TwoOrgsOrdererGenesis"
-	genesisBlock        = "/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/test-network/system-genesis-block/genesis.block"
-	ordererMSPDir       = "/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/test-network/organizations/ordererOrganizations/example.com/msp"
-	sdkOrgMSPDir        = "/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/test-network/organizations/peerOrganizations/org1.example.com/msp"
-	org2MSPDir          = "/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/test-network/organizations/peerOrganizations/org2.example.com/msp"
+	systemChannelName = "system-channel"
+	// profiles of the bundled configtx.yaml used when a request names none
+	genesisBlockProfile  = "TwoOrgsOrdererGenesis"
+	channelCreateProfile = "TwoOrgsChannel"
 
 	sdkOrg   = "Org1"
 	sdkAdmin = "Admin"
+
+	defaultConsortium = "SampleConsortium"
 )
 
-var channelCreateTx = fmt.Sprintf("/Users/slackbuffer/go/src/github.com/hyperledger/fabric/fabric-samples/test-network/channel-artifacts/%s.tx", channelName)
+type genesisBlockRequest struct {
+	identityRequest
+	ChannelID string `json:"channelID,omitempty"`
+	// Profile names a profile of the configtx.yaml at ConfigtxPath that describes the whole network,
+	// instead of the orderer and consortium fields below. Without either the bundled
+	// TwoOrgsOrdererGenesis profile is used.
+	Profile          string           `json:"profile,omitempty"`
+	ConfigtxPath     string           `json:"configtxPath,omitempty"`
+	OrdererType      string           `json:"ordererType,omitempty"`
+	OrdererAddresses []string         `json:"ordererAddresses"`
+	OrdererOrgs      []orgRequest     `json:"ordererOrgs"`
+	Consortium       string           `json:"consortium,omitempty"`
+	ConsortiumOrgs   []orgRequest     `json:"consortiumOrgs"`
+	Batch            batchRequest     `json:"batch"`
+	EtcdRaft         *etcdRaftRequest `json:"etcdRaft,omitempty"`
+	PBFT             *pbftRequest     `json:"pbft,omitempty"`
+	// Store keeps the block in the artifact store.
+	Store bool `json:"store,omitempty"`
+}
 
-func createGenesisBlock(w http.ResponseWriter, r *http.Request) {
-	var err error
-	if strings.HasPrefix(r.RequestURI, "/gm") {
-		err = doCreateGenesisBlock(gmConfigFilePath)
-	} else {
-		err = doCreateGenesisBlock(configFilePath)
+func (r *genesisBlockRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		r.ChannelID = systemChannelName
 	}
-	if err != nil {
-		log.Println(err.Error())
-		io.WriteString(w, err.Error())
-		return
+	fields := r.OrdererType != "" || len(r.OrdererAddresses) > 0 || len(r.OrdererOrgs) > 0 || r.Consortium != "" || len(r.ConsortiumOrgs) > 0 ||
+		r.Batch != (batchRequest{}) || r.EtcdRaft != nil || r.PBFT != nil
+	if r.Profile == "" && !fields {
+		r.Profile = genesisBlockProfile
 	}
-	io.WriteString(w, "create genesis block ok")
-}
-
-func doCreateGenesisBlock(sdkConfigFilePath string) error {
-	sdk, err := fabsdk.New(config.FromFile(sdkConfigFilePath))
-	if err != nil {
-		return err
+	if r.Profile != "" {
+		if fields {
+			return fmt.Errorf("profile is mutually exclusive with the orderer and consortium fields")
+		}
+		return nil
 	}
-	defer sdk.Close()
-	clientContextProvider := sdk.Context(fabsdk.WithUser(sdkAdmin), fabsdk.WithOrg(sdkOrg))
-	cc, err := clientContextProvider()
-	if err != nil {
-		return err
+	if r.OrdererType == "" {
+		r.OrdererType = genesisconfig.ConsensusTypeEtcdRaft
 	}
-	ho := cc.SigningManager().GetHashOpts()
-
-	ordererOrg := &genesisconfig.Organization{
-		Name:   "OrdererOrg",
-		ID:     "OrdererMSP",
-		MSPDir: ordererMSPDir,
+	if r.Consortium == "" {
+		r.Consortium = defaultConsortium
+	}
+	if len(r.OrdererAddresses) == 0 {
+		return fmt.Errorf("ordererAddresses is required")
 	}
-	sdkOrg := &genesisconfig.Organization{
-		Name:   "Org1MSP",
-		ID:     "Org1MSP",
-		MSPDir: sdkOrgMSPDir,
+	if err := validateOrgs("ordererOrgs", r.OrdererOrgs); err != nil {
+		return err
 	}
-	org2 := &genesisconfig.Organization{
-		Name:   "Org2MSP",
-		ID:     "Org2MSP",
-		MSPDir: org2MSPDir,
+	if err := validateOrgs("consortiumOrgs", r.ConsortiumOrgs); err != nil {
+		return err
 	}
-
-	gc := &genesisconfig.GenesisConfig{
-		ChainID:         systemChannelName,
-		OrdererType:     "solo",
-		Addresses:       []string{fmt.Sprintf("%s:%d", ordererEndpoint, ordererPort)},
-		BatchTimeout:    2 * time.Second,
-		MaxMessageCount: 10,
-		// 2022-12-01 08:55:23.780 UTC [orderer.common.broadcast] ProcessMessage -> WARN 014 [channel: mychannel] Rejecting broadcast of config message from 172.26.0.1:35544 because of error: message payload is 22798 bytes and exceeds maximum allowed 4096 bytes
-		AbsoluteMaxBytes:        103809024,
-		PreferredMaxBytes:       524288,
-		OrdererOrganizations:    []*genesisconfig.Organization{ordererOrg},
-		ConsortiumOrganizations: []*genesisconfig.Organization{sdkOrg, org2},
-		AdminsPolicy:            genesisconfig.PolicyAnyAdmins,
-		WritersPolicy:           genesisconfig.PolicyAllWriters,
-		ReadersPolicy:           genesisconfig.PolicyAllReaders,
+	for _, orgs := range [][]orgRequest{r.OrdererOrgs, r.ConsortiumOrgs} {
+		for _, org := range orgs {
+			if len(org.AnchorPeers) > 0 {
+				return fmt.Errorf("org %s: anchor peers are set per channel, not in the genesis block", org.Name)
+			}
+		}
 	}
-	profile := genesisconfig.NewGenesisProfile(gc)
-	gbbs, err := resource.CreateGenesisBlockForOrdererWithHashOpts(profile, systemChannelName, cc.CryptoSuite(), ho)
-	if err != nil {
+	if err := r.Batch.validate(); err != nil {
 		return err
 	}
-
-	err = writeFile(genesisBlock, gbbs, 0640)
-	if err != nil {
-		return fmt.Errorf("error writing genesis block: %s", err)
+	switch r.OrdererType {
+	case genesisconfig.ConsensusTypeEtcdRaft:
+		if r.EtcdRaft == nil {
+			return fmt.Errorf("etcdRaft is required for ordererType %s", r.OrdererType)
+		}
+		return r.EtcdRaft.validate()
+	case genesisconfig.ConsensusTypePBFT:
+		if r.PBFT == nil {
+			return fmt.Errorf("pbft is required for ordererType %s", r.OrdererType)
+		}
+		ordererMSPs := make(map[string]bool)
+		for _, org := range r.OrdererOrgs {
+			ordererMSPs[org.MSPID] = true
+		}
+		return r.PBFT.validate(ordererMSPs)
 	}
+	return fmt.Errorf("unsupported ordererType %q", r.OrdererType)
+}
 
-	return nil
+type channelCreateTxRequest struct {
+	identityRequest
+	ChannelID string `json:"channelID"`
+	// Profile names a channel profile of the configtx.yaml at ConfigtxPath, by default the bundled
+	// TwoOrgsChannel profile.
+	Profile      string `json:"profile,omitempty"`
+	ConfigtxPath string `json:"configtxPath,omitempty"`
+	Store        bool   `json:"store,omitempty"`
 }
 
-func createChannelCreateTx(w http.ResponseWriter, r *http.Request) {
-	var err error
-	if strings.HasPrefix(r.RequestURI, "/gm") {
-		err = doCreateChannelCreateTx(gmConfigFilePath)
-	} else {
-		err = doCreateChannelCreateTx(configFilePath)
+func (r *channelCreateTxRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
 	}
-	if err != nil {
-		log.Println(err.Error())
-		io.WriteString(w, err.Error())
-		return
+	if r.Profile == "" {
+		r.Profile = channelCreateProfile
 	}
-	io.WriteString(w, "create channel create tx ok")
+	return nil
 }
 
-func doCreateChannelCreateTx(sdkConfigFilePath string) error {
-	// sdk, err := fabsdk.New(config.FromFile(sdkConfigFilePath))
-	// if err != nil {
-	// 	return err
-	// }
-	// defer sdk.Close()
-	// clientContextProvider := sdk.Context(fabsdk.WithUser(sdkAdmin), fabsdk.WithOrg(sdkOrg))
+// genesisOrg converts the request to an organization entry of a genesis block.
+func (r orgRequest) genesisOrg() *genesisconfig.Organization {
+	return &genesisconfig.Organization{
+		Name:   r.Name,
+		ID:     r.MSPID,
+		MSPDir: r.MSPDir,
+	}
+}
 
-	// cc, err := clientContextProvider()
-	// if err != nil {
-	// 	return err
-	// }
-	// ho := cc.SigningManager().GetHashOpts()
+// policies returns the defaults with the policies given in the request replacing them by name.
+func (r orgRequest) policies(defaults map[string]*genesisconfig.Policy) map[string]*genesisconfig.Policy {
+	if len(r.Policies) == 0 {
+		return defaults
+	}
+	policies := make(map[string]*genesisconfig.Policy, len(defaults)+len(r.Policies))
+	for name, p := range defaults {
+		policies[name] = p
+	}
+	for name, p := range r.Policies {
+		policies[name] = &genesisconfig.Policy{Type: p.Type, Rule: p.Rule}
+	}
+	return policies
+}
 
-	sdkOrg := &genesisconfig.Organization{
-		Name:    "Org1MSP",
-		ID:      "Org1MSP",
-		MSPDir:  sdkOrgMSPDir,
+// channelOrg converts the request to an application organization with the default member policies.
+func (r orgRequest) channelOrg() *genesisconfig.Organization {
+	org := &genesisconfig.Organization{
+		Name:    r.Name,
+		ID:      r.MSPID,
+		MSPDir:  r.MSPDir,
 		MSPType: "bccsp",
-		Policies: map[string]*genesisconfig.Policy{
+		Policies: r.policies(map[string]*genesisconfig.Policy{
 			"Admins": {
 				Type: "Signature",
-				Rule: "OR('Org1MSP.admin')",
+				Rule: fmt.Sprintf("OR('%s.admin')", r.MSPID),
 			},
 			"Readers": {
 				Type: "Signature",
-				Rule: "OR('Org1MSP.admin', 'Org1MSP.peer', 'Org1MSP.client')",
+				Rule: fmt.Sprintf("OR('%[1]s.admin', '%[1]s.peer', '%[1]s.client')", r.MSPID),
 			},
 			"Writers": {
 				Type: "Signature",
-				Rule: "OR('Org1MSP.admin', 'Org1MSP.client')",
+				Rule: fmt.Sprintf("OR('%[1]s.admin', '%[1]s.client')", r.MSPID),
 			},
 			"Endorsement": {
 				Type: "Signature",
-				Rule: "OR('Org1MSP.peer')",
+				Rule: fmt.Sprintf("OR('%s.peer')", r.MSPID),
 			},
-		},
+		}),
 	}
-	org2 := &genesisconfig.Organization{
-		Name:    "Org2MSP",
-		ID:      "Org2MSP",
-		MSPDir:  org2MSPDir,
-		MSPType: "bccsp",
-		Policies: map[string]*genesisconfig.Policy{
-			"Admins": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.admin')",
-			},
-			"Readers": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.admin', 'Org2MSP.peer', 'Org2MSP.client')",
-			},
-			"Writers": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.admin', 'Org2MSP.client')",
-			},
-			"Endorsement": {
-				Type: "Signature",
-				Rule: "OR('Org2MSP.peer')",
-			},
-		},
+	for _, ap := range r.AnchorPeers {
+		org.AnchorPeers = append(org.AnchorPeers, &genesisconfig.AnchorPeer{Host: ap.Host, Port: ap.Port})
 	}
+	return org
+}
 
-	gp := &genesisconfig.Profile{
-		Consortium: "SampleConsortium",
-		Policies: map[string]*genesisconfig.Policy{
-			"Admins": {
-				Type: "ImplicitMeta",
-				Rule: "ANY Admins",
-			},
-			"Readers": {
-				Type: "ImplicitMeta",
-				Rule: "ANY Readers",
-			},
-			"Writers": {
-				Type: "ImplicitMeta",
-				Rule: "ANY Writers",
-			},
-			"Endorsement": {
-				Type: "ImplicitMeta",
-				Rule: "ANY Writers",
-			},
-		},
-		Application: &genesisconfig.Application{
-			ACLs: map[string]string{
-				"_lifecycle/CommitChaincodeDefinition": "/Channel/Application/Writers",
-				"_lifecycle/QueryChaincodeDefinition":  "/Channel/Application/Readers",
-				"_lifecycle/QueryNamespaceDefinitions": "/Channel/Application/Readers",
-				"lscc/ChaincodeExists":                 "/Channel/Application/Readers",
-				"lscc/GetDeploymentSpec":               "/Channel/Application/Readers",
-				"lscc/GetChaincodeData":                "/Channel/Application/Readers",
-				"lscc/GetInstantiatedChaincodes":       "/Channel/Application/Readers",
-				"qscc/GetChainInfo":                    "/Channel/Application/Readers",
-				"qscc/GetBlockByNumber":                "/Channel/Application/Readers",
-				"qscc/GetBlockByHash":                  "/Channel/Application/Readers",
-				"qscc/GetTransactionByID":              "/Channel/Application/Readers",
-				"qscc/GetBlockByTxID":                  "/Channel/Application/Readers",
-				"cscc/GetConfigBlock":                  "/Channel/Application/Readers",
-				"cscc/GetConfigTree":                   "/Channel/Application/Readers",
-				"cscc/SimulateConfigTreeUpdate":        "/Channel/Application/Readers",
-				"peer/Propose":                         "/Channel/Application/Writers",
-				"peer/ChaincodeToChaincode":            "/Channel/Application/Readers",
-				"event/Block":                          "/Channel/Application/Readers",
-				"event/FilteredBlock":                  "/Channel/Application/Readers",
-			},
-			Organizations: []*genesisconfig.Organization{sdkOrg, org2},
-			Policies: map[string]*genesisconfig.Policy{
-				"LifecycleEndorsement": {
-					Type: "Signature",
-					Rule: "OR('Org1MSP.peer')",
-				},
-				"Endorsement": {
-					Type: "Signature",
-					Rule: "OR('Org1MSP.peer')",
-				},
-				"Readers": {
-					Type: "ImplicitMeta",
-					Rule: "ANY Readers",
-				},
-				"Writers": {
-					Type: "ImplicitMeta",
-					Rule: "ANY Writers",
-				},
-				"Admins": {
-					Type: "ImplicitMeta",
-					Rule: "ANY Admins",
-				},
-			},
-			Capabilities: map[string]bool{
-				"V2_0": true,
-			},
-		},
+func createGenesisBlock(w http.ResponseWriter, r *http.Request) {
+	var req genesisBlockRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
 	}
-	cctBytes, err := resource.CreateChannelCreateTx(gp, nil, channelName)
+	result, err := doCreateGenesisBlock(sdkProfileOf(r), &req)
 	if err != nil {
-		return err
+		writeError(w, err)
+		return
 	}
-	err = writeFile(channelCreateTx, cctBytes, 0640)
+	writeArtifact(w, r, result)
+}
+
+func doCreateGenesisBlock(profile sdkProfile, req *genesisBlockRequest) (result *artifactResult, err error) {
+	sdk, err := sdks.acquire(profile)
 	if err != nil {
-		return fmt.Errorf("error writing channel create transaction error: %s", err)
+		return nil, err
 	}
+	defer sdk.release(&err)
+	clientContextProvider := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))
+	cc, err := clientContextProvider()
+	if err != nil {
+		return nil, err
+	}
+	ho := cc.SigningManager().GetHashOpts()
 
-	return nil
+	var gp *genesisconfig.Profile
+	if req.Profile != "" {
+		gp, err = loadConfigtxProfile(req.ConfigtxPath, req.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if gp.Orderer == nil || len(gp.Consortiums) == 0 {
+			return nil, badRequest("profile %s has no orderer or consortiums section, it cannot bootstrap an orderer", req.Profile)
+		}
+	} else {
+		gp = req.genesisProfile()
+	}
+	gbbs, err := resource.CreateGenesisBlockForOrdererWithHashOpts(gp, req.ChannelID, cc.CryptoSuite(), ho)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = newArtifact(cc, req.ChannelID+".block", gbbs)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveArtifact(result, req.Store); err != nil {
+		return nil, fmt.Errorf("error saving genesis block: %v", err)
+	}
+	return result, nil
+}
+
+// genesisProfile builds the genesis profile from the orderer and consortium fields of the request.
+func (req *genesisBlockRequest) genesisProfile() *genesisconfig.Profile {
+	var ordererOrgs, consortiumOrgs []*genesisconfig.Organization
+	for _, org := range req.OrdererOrgs {
+		ordererOrgs = append(ordererOrgs, org.genesisOrg())
+	}
+	for _, org := range req.ConsortiumOrgs {
+		consortiumOrgs = append(consortiumOrgs, org.genesisOrg())
+	}
+
+	gc := &genesisconfig.GenesisConfig{
+		ChainID:                 req.ChannelID,
+		OrdererType:             req.OrdererType,
+		Addresses:               req.OrdererAddresses,
+		BatchTimeout:            req.Batch.timeout,
+		MaxMessageCount:         req.Batch.MaxMessageCount,
+		AbsoluteMaxBytes:        req.Batch.AbsoluteMaxBytes,
+		PreferredMaxBytes:       req.Batch.PreferredMaxBytes,
+		OrdererOrganizations:    ordererOrgs,
+		ConsortiumOrganizations: consortiumOrgs,
+		ConsortiumName:          req.Consortium,
+		AdminsPolicy:            genesisconfig.PolicyAnyAdmins,
+		WritersPolicy:           genesisconfig.PolicyAllWriters,
+		ReadersPolicy:           genesisconfig.PolicyAllReaders,
+	}
+	if req.EtcdRaft != nil {
+		gc.EtcdRaft = req.EtcdRaft.configMetadata()
+	}
+	if req.PBFT != nil {
+		gc.PBFT = req.PBFT.configMetadata()
+	}
+	gp := genesisconfig.NewGenesisProfile(gc)
+	// NewGenesisProfile gives every org the default policies, put the requested ones back
+	for i, org := range gp.Orderer.Organizations {
+		org.Policies = req.OrdererOrgs[i].policies(org.Policies)
+	}
+	for _, consortium := range gp.Consortiums {
+		for i, org := range consortium.Organizations {
+			org.Policies = req.ConsortiumOrgs[i].policies(org.Policies)
+		}
+	}
+	return gp
+}
+
+func createChannelCreateTx(w http.ResponseWriter, r *http.Request) {
+	var req channelCreateTxRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doCreateChannelCreateTx(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeArtifact(w, r, result)
+}
+
+func doCreateChannelCreateTx(profile sdkProfile, req *channelCreateTxRequest) (result *artifactResult, err error) {
+	cctBytes, err := req.createTx()
+	if err != nil {
+		return nil, err
+	}
+
+	// the sdk is only needed for the digest, which follows the hash algorithm of the profile
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+	cc, err := sdk.Context(fabsdk.WithUser(req.User), fabsdk.WithOrg(req.Org))()
+	if err != nil {
+		return nil, err
+	}
+	result, err = newArtifact(cc, req.ChannelID+".tx", cctBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveArtifact(result, req.Store); err != nil {
+		return nil, fmt.Errorf("error saving channel create transaction: %v", err)
+	}
+	return result, nil
+}
+
+// createTx builds the channel creation transaction from the configtx profile.
+func (req *channelCreateTxRequest) createTx() ([]byte, error) {
+	gp, err := req.createProfile()
+	if err != nil {
+		return nil, err
+	}
+	return resource.CreateChannelCreateTx(gp, nil, req.ChannelID)
+}
+
+func (req *channelCreateTxRequest) createProfile() (*genesisconfig.Profile, error) {
+	gp, err := loadConfigtxProfile(req.ConfigtxPath, req.Profile)
+	if err != nil {
+		return nil, err
+	}
+	if gp.Application == nil || gp.Consortium == "" {
+		return nil, badRequest("profile %s has no consortium or application section, it cannot create a channel", req.Profile)
+	}
+	return gp, nil
 }
 
 func writeFile(filename string, data []byte, perm os.FileMode) error {
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource/genesisconfig"
+)
+
+const defaultOrdererChangeTimeout = time.Minute
+
+// status of a consenter change on one channel
+const (
+	changeCommitted = "committed"
+	changeUnchanged = "unchanged"
+	changeFailed    = "failed"
+	changeSkipped   = "skipped"
+	// changePlanned is a change previewed by a dry run
+	changePlanned = "planned"
+)
+
+// ordererNodeRequest is an orderer joining or leaving the raft cluster. Address is its client
+// endpoint in OrdererAddresses, the certificates are only needed when it is added.
+type ordererNodeRequest struct {
+	raftConsenterRequest
+	Address string `json:"address,omitempty"`
+}
+
+func (n ordererNodeRequest) String() string {
+	return fmt.Sprintf("%s:%d", n.Host, n.Port)
+}
+
+// ordererMembershipRequest is the body of /network/orderers. Every node is changed on the system
+// channel and then on each application channel, and committed there, before the next one is changed
+// so the cluster keeps its quorum. Added nodes go first.
+type ordererMembershipRequest struct {
+	identityRequest
+	Add    []ordererNodeRequest `json:"add,omitempty"`
+	Remove []ordererNodeRequest `json:"remove,omitempty"`
+	// application channels served by the cluster
+	Channels          []string `json:"channels,omitempty"`
+	SystemChannel     string   `json:"systemChannel,omitempty"`
+	SkipSystemChannel bool     `json:"skipSystemChannel,omitempty"`
+	// Signers sign every update and must satisfy the orderer admins policy, the request identity by default.
+	Signers []identityRequest `json:"signers,omitempty"`
+	Orderer string            `json:"orderer,omitempty"`
+	// Timeout bounds waiting for one change to be committed on one channel, e.g. "2m".
+	Timeout string `json:"timeout,omitempty"`
+
+	timeout time.Duration
+	dryRun  bool
+}
+
+func (r *ordererMembershipRequest) validate() error {
+	r.setDefaults()
+	if len(r.Add) == 0 && len(r.Remove) == 0 {
+		return fmt.Errorf("add or remove is required")
+	}
+	seen := make(map[string]bool)
+	for _, n := range r.Add {
+		raft := etcdRaftRequest{Consenters: []raftConsenterRequest{n.raftConsenterRequest}}
+		if err := raft.validate(); err != nil {
+			return err
+		}
+		if err := checkOrdererAddress(n.Address); err != nil {
+			return err
+		}
+		if seen[n.String()] {
+			return fmt.Errorf("duplicate orderer %s", n)
+		}
+		seen[n.String()] = true
+	}
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	// the sdk orderer is named by host, possibly with a port
+	submitHost := r.Orderer
+	if host, _, err := net.SplitHostPort(r.Orderer); err == nil {
+		submitHost = host
+	}
+	for _, n := range r.Remove {
+		if n.Host == "" || n.Port == 0 || n.Port > 65535 {
+			return fmt.Errorf("invalid consenter %s", n)
+		}
+		if err := checkOrdererAddress(n.Address); err != nil {
+			return err
+		}
+		addrHost, _, _ := net.SplitHostPort(n.Address)
+		if n.Host == submitHost || addrHost == submitHost {
+			return fmt.Errorf("orderer %s is removed, send the updates to another one", n)
+		}
+		if seen[n.String()] {
+			return fmt.Errorf("duplicate orderer %s", n)
+		}
+		seen[n.String()] = true
+	}
+	if r.SkipSystemChannel && len(r.Channels) == 0 {
+		return fmt.Errorf("channels is required when the system channel is skipped")
+	}
+	if r.SystemChannel == "" {
+		r.SystemChannel = systemChannelName
+	}
+	for _, ch := range r.Channels {
+		if ch == "" || ch == r.SystemChannel {
+			return fmt.Errorf("invalid channel %q", ch)
+		}
+	}
+	for i := range r.Signers {
+		r.Signers[i].setDefaults()
+	}
+	if len(r.Signers) == 0 {
+		r.Signers = []identityRequest{r.identityRequest}
+	}
+	timeout, err := parseTimeout("timeout", r.Timeout)
+	if err != nil {
+		return err
+	}
+	r.timeout = timeout
+	if r.timeout == 0 {
+		r.timeout = defaultOrdererChangeTimeout
+	}
+	return nil
+}
+
+func checkOrdererAddress(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("invalid orderer address %q", addr)
+	}
+	return nil
+}
+
+// ordererChange is the progress of one node change on one channel.
+type ordererChange struct {
+	Node        string  `json:"node"`
+	Op          string  `json:"op"` // add or remove
+	ChannelID   string  `json:"channelID"`
+	Status      string  `json:"status"`
+	TxID        string  `json:"txID,omitempty"`
+	BlockNumber *uint64 `json:"blockNumber,omitempty"`
+	Error       string  `json:"error,omitempty"`
+	// DryRun is the previewed update of a dry run
+	DryRun *configProposal `json:"dryRun,omitempty"`
+}
+
+type ordererMembershipResult struct {
+	Completed bool             `json:"completed"`
+	Changes   []*ordererChange `json:"changes"`
+}
+
+func updateOrdererMembership(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	req := ordererMembershipRequest{dryRun: dryRun}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	result, err := doUpdateOrdererMembership(sdkProfileOf(r), &req)
+	if err != nil && result == nil {
+		writeError(w, err)
+		return
+	}
+	if err != nil {
+		// report how far it got together with the error
+		log.Println(err.Error())
+		writeResponse(w, apiResponse{Result: result, Error: &apiError{Status: http.StatusInternalServerError, Message: err.Error()}})
+		return
+	}
+	writeResponse(w, apiResponse{Result: result})
+}
+
+func doUpdateOrdererMembership(profile sdkProfile, req *ordererMembershipRequest) (result *ordererMembershipResult, err error) {
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	var channels []string
+	if !req.SkipSystemChannel {
+		channels = append(channels, req.SystemChannel)
+	}
+	channels = append(channels, req.Channels...)
+
+	// plan every change first so a failure leaves the rest reported as skipped
+	result = &ordererMembershipResult{}
+	type step struct {
+		node ordererNodeRequest
+		add  bool
+	}
+	var steps []step
+	for _, n := range req.Add {
+		steps = append(steps, step{n, true})
+	}
+	for _, n := range req.Remove {
+		steps = append(steps, step{n, false})
+	}
+	var changes [][]*ordererChange
+	for _, s := range steps {
+		op := "remove"
+		if s.add {
+			op = "add"
+		}
+		var cs []*ordererChange
+		for _, ch := range channels {
+			c := &ordererChange{Node: s.node.String(), Op: op, ChannelID: ch, Status: changeSkipped}
+			cs = append(cs, c)
+			result.Changes = append(result.Changes, c)
+		}
+		changes = append(changes, cs)
+	}
+
+	// a dry run previews every step on the config the previous steps result in
+	var planned map[string]*common.Config
+	if req.dryRun {
+		planned = make(map[string]*common.Config)
+	}
+	for i, s := range steps {
+		for _, c := range changes[i] {
+			if err := changeOrdererNode(sdk, req, c, s.node, s.add, planned); err != nil {
+				c.Status = changeFailed
+				c.Error = err.Error()
+				return result, fmt.Errorf("failed to %s orderer %s on channel %s: %v", c.Op, c.Node, c.ChannelID, err)
+			}
+			log.Printf("%s orderer %s on channel %s: %s\n", c.Op, c.Node, c.ChannelID, c.Status)
+		}
+	}
+	result.Completed = true
+	return result, nil
+}
+
+// changeOrdererNode adds or removes one node on one channel and waits until the new config is committed.
+// On a dry run the change is previewed on the planned config of the channel instead.
+func changeOrdererNode(sdk *pooledSDK, req *ordererMembershipRequest, c *ordererChange, node ordererNodeRequest, add bool, planned map[string]*common.Config) error {
+	block, config, err := plannedChannelConfig(sdk, req.identityRequest, c.ChannelID, req.Orderer, planned)
+	if err != nil {
+		return err
+	}
+	consenters, err := genesisconfig.ExtractRaftNodesFromConfig(config)
+	if err != nil {
+		return err
+	}
+	isConsenter, sameCerts := false, false
+	for _, cur := range consenters {
+		if cur.Host != node.Host || cur.Port != node.Port {
+			continue
+		}
+		isConsenter = true
+		if add {
+			requested, err := node.consenter()
+			if err != nil {
+				return err
+			}
+			sameCerts = samePEM(cur.ClientTlsCert, requested.ClientTlsCert) && samePEM(cur.ServerTlsCert, requested.ServerTlsCert)
+		}
+	}
+	addresses, err := channelOrdererAddresses(config)
+	if err != nil {
+		return err
+	}
+	hasAddress := false
+	for _, addr := range addresses {
+		hasAddress = hasAddress || addr == node.Address
+	}
+
+	var ops []configOperation
+	if add {
+		if !sameCerts {
+			ops = append(ops, configOperation{Op: opAddOrUpdateRaftNodes, Consenters: []raftConsenterRequest{node.raftConsenterRequest}})
+		}
+		if node.Address != "" && !hasAddress {
+			ops = append(ops, configOperation{Op: opAddOrdererAddresses, Addresses: []string{node.Address}})
+		}
+	} else {
+		if isConsenter {
+			if len(consenters) == 1 {
+				return badRequest("%s is the last consenter of %s", node, c.ChannelID)
+			}
+			ops = append(ops, configOperation{Op: opDelRaftNodes, Consenters: []raftConsenterRequest{node.raftConsenterRequest}})
+		}
+		if node.Address != "" && hasAddress {
+			if len(addresses) == 1 {
+				return badRequest("%s is the last orderer address of %s", node.Address, c.ChannelID)
+			}
+			ops = append(ops, configOperation{Op: opDelOrdererAddresses, Addresses: []string{node.Address}})
+		}
+	}
+	if len(ops) == 0 {
+		c.Status = changeUnchanged
+		return nil
+	}
+	tx, err := applyConfigOperations(c.ChannelID, config, ops)
+	if err != nil {
+		return err
+	}
+	if req.dryRun {
+		p, updated, err := dryRunConfigUpdate(sdk, req.identityRequest, req.Signers, c.ChannelID, req.Orderer, config, tx)
+		if err != nil {
+			return err
+		}
+		planned[c.ChannelID] = updated
+		c.DryRun, c.Status = p, changePlanned
+		return nil
+	}
+
+	txID, blockNumber, err := commitConfigUpdate(sdk, req.identityRequest, req.Signers, c.ChannelID, req.Orderer, req.timeout, block, config, tx, func(config *common.Config) (bool, error) {
+		consenters, err := genesisconfig.ExtractRaftNodesFromConfig(config)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, cur := range consenters {
+			found = found || (cur.Host == node.Host && cur.Port == node.Port)
+		}
+		return found == add, nil
+	})
+	c.TxID = txID
+	if err != nil {
+		return err
+	}
+	c.BlockNumber = &blockNumber
+	c.Status = changeCommitted
+	return nil
+}
+
+// samePEM reports whether two PEM encodings hold the same blocks.
+func samePEM(a, b []byte) bool {
+	for {
+		var blockA, blockB *pem.Block
+		blockA, a = pem.Decode(a)
+		blockB, b = pem.Decode(b)
+		if blockA == nil || blockB == nil {
+			return blockA == nil && blockB == nil
+		}
+		if blockA.Type != blockB.Type || !bytes.Equal(blockA.Bytes, blockB.Bytes) {
+			return false
+		}
+	}
+}
+
+// plannedChannelConfig returns the config a dry run has planned for the channel so far, the latest
+// config of the channel if there is none.
+func plannedChannelConfig(sdk *pooledSDK, identity identityRequest, channelID, orderer string, planned map[string]*common.Config) (*common.Block, *common.Config, error) {
+	if config, ok := planned[channelID]; ok {
+		return nil, config, nil
+	}
+	return queryChannelConfig(sdk, identity, channelID, orderer)
+}
+
+func channelOrdererAddresses(config *common.Config) ([]string, error) {
+	v, ok := config.ChannelGroup.Values[ordererAddressesKey]
+	if !ok {
+		return nil, nil
+	}
+	addrs := &common.OrdererAddresses{}
+	if err := proto.Unmarshal(v.Value, addrs); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", ordererAddressesKey, err)
+	}
+	return addrs.Addresses, nil
+}
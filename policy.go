@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hyperledger-TWGC/ccs-gm/sm2"
+	"github.com/Hyperledger-TWGC/ccs-gm/sm3"
+	gmx509 "github.com/Hyperledger-TWGC/ccs-gm/x509"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+)
+
+// signaturePolicyString renders a signature policy in the DSL accepted by policydsl.FromString,
+// e.g. OR('Org1MSP.member','Org2MSP.member').
+func signaturePolicyString(env *common.SignaturePolicyEnvelope) string {
+	if env == nil || env.Rule == nil {
+		return ""
+	}
+	return signaturePolicyRuleString(env.Rule, env.Identities)
+}
+
+func signaturePolicyRuleString(rule *common.SignaturePolicy, identities []*mspproto.MSPPrincipal) string {
+	switch t := rule.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if int(t.SignedBy) >= len(identities) {
+			return fmt.Sprintf("'<invalid identity %d>'", t.SignedBy)
+		}
+		return "'" + principalString(identities[t.SignedBy]) + "'"
+	case *common.SignaturePolicy_NOutOf_:
+		rules := make([]string, 0, len(t.NOutOf.Rules))
+		for _, r := range t.NOutOf.Rules {
+			rules = append(rules, signaturePolicyRuleString(r, identities))
+		}
+		switch {
+		case int(t.NOutOf.N) == len(rules):
+			return "AND(" + strings.Join(rules, ",") + ")"
+		case t.NOutOf.N == 1:
+			return "OR(" + strings.Join(rules, ",") + ")"
+		}
+		return fmt.Sprintf("OutOf(%d,%s)", t.NOutOf.N, strings.Join(rules, ","))
+	}
+	return "<unknown rule>"
+}
+
+func principalString(p *mspproto.MSPPrincipal) string {
+	switch p.PrincipalClassification {
+	case mspproto.MSPPrincipal_ROLE:
+		role := &mspproto.MSPRole{}
+		if err := proto.Unmarshal(p.Principal, role); err != nil {
+			return "<invalid role>"
+		}
+		return role.MspIdentifier + "." + strings.ToLower(role.Role.String())
+	case mspproto.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &mspproto.OrganizationUnit{}
+		if err := proto.Unmarshal(p.Principal, ou); err != nil {
+			return "<invalid organization unit>"
+		}
+		return ou.MspIdentifier + ".ou:" + ou.OrganizationalUnitIdentifier
+	}
+	return "<" + strings.ToLower(p.PrincipalClassification.String()) + ">"
+}
+
+// endorsementPolicy is the endorsement policy of a chaincode definition, given as one of: the MSPs any
+// member of which may endorse, a signature policy DSL string, or a reference to a channel config policy.
+type endorsementPolicy struct {
+	EndorsingMSPs       []string `json:"endorsingMSPs,omitempty"`
+	SignaturePolicy     string   `json:"signaturePolicy,omitempty"`     // e.g. AND('Org1MSP.peer','Org2MSP.peer')
+	ChannelConfigPolicy string   `json:"channelConfigPolicy,omitempty"` // e.g. /Channel/Application/Endorsement
+
+	policy *common.SignaturePolicyEnvelope
+}
+
+func (p *endorsementPolicy) validate() error {
+	set := 0
+	for _, ok := range []bool{len(p.EndorsingMSPs) > 0, p.SignaturePolicy != "", p.ChannelConfigPolicy != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return fmt.Errorf("endorsingMSPs, signaturePolicy and channelConfigPolicy are mutually exclusive")
+	}
+	if p.SignaturePolicy != "" {
+		env, err := policydsl.FromString(p.SignaturePolicy)
+		if err != nil {
+			return fmt.Errorf("invalid signaturePolicy %q: %v", p.SignaturePolicy, err)
+		}
+		p.policy = env
+	}
+	if p.ChannelConfigPolicy != "" {
+		if err := validateChannelPolicyReference(p.ChannelConfigPolicy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *endorsementPolicy) isSet() bool {
+	return p.policy != nil || p.ChannelConfigPolicy != "" || len(p.EndorsingMSPs) > 0
+}
+
+// envelope returns the signature policy, nil for a channel config policy reference.
+func (p *endorsementPolicy) envelope() *common.SignaturePolicyEnvelope {
+	if p.policy == nil && len(p.EndorsingMSPs) > 0 {
+		p.policy = policydsl.SignedByAnyMember(p.EndorsingMSPs)
+	}
+	return p.policy
+}
+
+func validateChannelPolicyReference(ref string) error {
+	if !strings.HasPrefix(ref, "/Channel/") || strings.HasSuffix(ref, "/") || strings.Contains(ref, "//") {
+		return fmt.Errorf("invalid channel config policy reference %q, expected a path such as /Channel/Application/Endorsement", ref)
+	}
+	return nil
+}
+
+// configSigner is the creator of a config signature, as the policies of a channel config see it.
+type configSigner struct {
+	mspID string
+	cert  []byte // DER
+	ous   []string
+}
+
+func configSignerOf(sig *common.ConfigSignature) (*configSigner, error) {
+	sh := &common.SignatureHeader{}
+	if err := proto.Unmarshal(sig.SignatureHeader, sh); err != nil {
+		return nil, fmt.Errorf("invalid signature header: %v", err)
+	}
+	id := &mspproto.SerializedIdentity{}
+	if err := proto.Unmarshal(sh.Creator, id); err != nil {
+		return nil, fmt.Errorf("invalid signature creator: %v", err)
+	}
+	block, _ := pem.Decode(id.IdBytes)
+	if block == nil {
+		return nil, fmt.Errorf("signature creator of %s has no PEM certificate", id.Mspid)
+	}
+	s := &configSigner{mspID: id.Mspid, cert: block.Bytes}
+	if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+		s.ous = cert.Subject.OrganizationalUnit
+	} else if cert, err := gmx509.ParseCertificate(block.Bytes); err == nil {
+		s.ous = cert.Subject.OrganizationalUnit
+	} else {
+		return nil, fmt.Errorf("invalid signature creator certificate of %s: %v", id.Mspid, err)
+	}
+	return s, nil
+}
+
+// verifyConfigSignature checks that sig signs configUpdate and that its creator's certificate chains
+// to the root certificates of its MSP in the channel config root.
+func verifyConfigSignature(root *common.ConfigGroup, configUpdate []byte, sig *common.ConfigSignature) error {
+	signer, err := configSignerOf(sig)
+	if err != nil {
+		return err
+	}
+	msps := make(map[string]*mspproto.FabricMSPConfig)
+	collectMSPs(root, msps)
+	conf, ok := msps[signer.mspID]
+	if !ok {
+		return fmt.Errorf("%s is not an MSP of the channel", signer.mspID)
+	}
+	signed := append(append([]byte{}, sig.SignatureHeader...), configUpdate...)
+
+	if cert, err := x509.ParseCertificate(signer.cert); err == nil {
+		// like fabric's MSP, validity periods are not part of the chain check
+		opts := x509.VerifyOptions{
+			Roots:         x509.NewCertPool(),
+			Intermediates: x509.NewCertPool(),
+			CurrentTime:   cert.NotBefore.Add(time.Second),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		for _, c := range conf.RootCerts {
+			opts.Roots.AppendCertsFromPEM(c)
+		}
+		for _, c := range conf.IntermediateCerts {
+			opts.Intermediates.AppendCertsFromPEM(c)
+		}
+		if _, err := cert.Verify(opts); err != nil {
+			return fmt.Errorf("certificate of the %s signer is not issued by the MSP: %v", signer.mspID, err)
+		}
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("certificate of the %s signer has no ECDSA key", signer.mspID)
+		}
+		if family := conf.GetCryptoConfig().GetSignatureHashFamily(); family != "" && family != "SHA2" {
+			return fmt.Errorf("MSP %s uses %s signatures, only SHA2 ones can be verified", signer.mspID, family)
+		}
+		digest := sha256.Sum256(signed)
+		if !ecdsa.VerifyASN1(pub, digest[:], sig.Signature) {
+			return fmt.Errorf("signature of the %s signer does not match the config update", signer.mspID)
+		}
+		return nil
+	}
+
+	cert, err := gmx509.ParseCertificate(signer.cert)
+	if err != nil {
+		return fmt.Errorf("invalid signature creator certificate of %s: %v", signer.mspID, err)
+	}
+	opts := gmx509.VerifyOptions{
+		Roots:         gmx509.NewCertPool(),
+		Intermediates: gmx509.NewCertPool(),
+		CurrentTime:   cert.NotBefore.Add(time.Second),
+		KeyUsages:     []gmx509.ExtKeyUsage{gmx509.ExtKeyUsageAny},
+	}
+	for _, c := range conf.RootCerts {
+		opts.Roots.AppendCertsFromPEM(c)
+	}
+	for _, c := range conf.IntermediateCerts {
+		opts.Intermediates.AppendCertsFromPEM(c)
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return fmt.Errorf("certificate of the %s signer is not issued by the MSP: %v", signer.mspID, err)
+	}
+	pub, ok := cert.PublicKey.(*sm2.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate of the %s signer has no SM2 key", signer.mspID)
+	}
+	// the gm csp signs the SM3 digest of the data
+	h := sm3.New()
+	h.Write(signed)
+	if !pub.Verify(h.Sum(nil), sig.Signature) {
+		return fmt.Errorf("signature of the %s signer does not match the config update", signer.mspID)
+	}
+	return nil
+}
+
+func (s *configSigner) hasOU(ou string) bool {
+	for _, o := range s.ous {
+		if o == ou {
+			return true
+		}
+	}
+	return false
+}
+
+// satisfies matches the signer against a principal the way the MSP of the channel would. The
+// certificate chain is not validated here, see verifyConfigSignature.
+func (s *configSigner) satisfies(p *mspproto.MSPPrincipal, msps map[string]*mspproto.FabricMSPConfig) bool {
+	switch p.PrincipalClassification {
+	case mspproto.MSPPrincipal_ROLE:
+		role := &mspproto.MSPRole{}
+		if proto.Unmarshal(p.Principal, role) != nil || role.MspIdentifier != s.mspID {
+			return false
+		}
+		conf := msps[s.mspID]
+		nodeOUs := conf.GetFabricNodeOus()
+		switch role.Role {
+		case mspproto.MSPRole_MEMBER:
+			return true
+		case mspproto.MSPRole_ADMIN:
+			for _, admin := range conf.GetAdmins() {
+				if block, _ := pem.Decode(admin); block != nil && bytes.Equal(block.Bytes, s.cert) {
+					return true
+				}
+			}
+			return nodeOUs.GetEnable() && nodeOUs.AdminOuIdentifier != nil && s.hasOU(nodeOUs.AdminOuIdentifier.OrganizationalUnitIdentifier)
+		case mspproto.MSPRole_PEER:
+			return nodeOUs.GetEnable() && nodeOUs.PeerOuIdentifier != nil && s.hasOU(nodeOUs.PeerOuIdentifier.OrganizationalUnitIdentifier)
+		case mspproto.MSPRole_CLIENT:
+			return nodeOUs.GetEnable() && nodeOUs.ClientOuIdentifier != nil && s.hasOU(nodeOUs.ClientOuIdentifier.OrganizationalUnitIdentifier)
+		case mspproto.MSPRole_ORDERER:
+			return nodeOUs.GetEnable() && nodeOUs.OrdererOuIdentifier != nil && s.hasOU(nodeOUs.OrdererOuIdentifier.OrganizationalUnitIdentifier)
+		}
+	case mspproto.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &mspproto.OrganizationUnit{}
+		return proto.Unmarshal(p.Principal, ou) == nil && ou.MspIdentifier == s.mspID && s.hasOU(ou.OrganizationalUnitIdentifier)
+	case mspproto.MSPPrincipal_IDENTITY:
+		id := &mspproto.SerializedIdentity{}
+		if proto.Unmarshal(p.Principal, id) != nil || id.Mspid != s.mspID {
+			return false
+		}
+		block, _ := pem.Decode(id.IdBytes)
+		return block != nil && bytes.Equal(block.Bytes, s.cert)
+	}
+	return false
+}
+
+// configPolicyEvaluator evaluates the policies of a channel config against a set of signers.
+type configPolicyEvaluator struct {
+	root    *common.ConfigGroup
+	msps    map[string]*mspproto.FabricMSPConfig
+	signers []*configSigner
+}
+
+func newConfigPolicyEvaluator(root *common.ConfigGroup, sigs []*common.ConfigSignature) (*configPolicyEvaluator, error) {
+	e := &configPolicyEvaluator{root: root, msps: make(map[string]*mspproto.FabricMSPConfig)}
+	collectMSPs(root, e.msps)
+	seen := make(map[string]bool)
+	for _, sig := range sigs {
+		s, err := configSignerOf(sig)
+		if err != nil {
+			return nil, err
+		}
+		// one identity counts once however often it signed
+		key := s.mspID + string(s.cert)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		e.signers = append(e.signers, s)
+	}
+	return e, nil
+}
+
+func collectMSPs(group *common.ConfigGroup, msps map[string]*mspproto.FabricMSPConfig) {
+	if v, ok := group.Values[mspKey]; ok {
+		mc := &mspproto.MSPConfig{}
+		conf := &mspproto.FabricMSPConfig{}
+		if proto.Unmarshal(v.Value, mc) == nil && proto.Unmarshal(mc.Config, conf) == nil {
+			msps[conf.Name] = conf
+		}
+	}
+	for _, g := range group.Groups {
+		collectMSPs(g, msps)
+	}
+}
+
+// evaluate reports whether the policy at path, e.g. /Channel/Application/Admins, is satisfied.
+func (e *configPolicyEvaluator) evaluate(path string) (bool, error) {
+	cp := lookupConfigPolicy(e.root, path)
+	if cp == nil || cp.Policy == nil {
+		return false, fmt.Errorf("policy %s is not found", path)
+	}
+	groupPath := path[:strings.LastIndex(path, "/")]
+	group := lookupConfigGroup(e.root, groupPath)
+	switch common.Policy_PolicyType(cp.Policy.Type) {
+	case common.Policy_SIGNATURE:
+		env := &common.SignaturePolicyEnvelope{}
+		if err := proto.Unmarshal(cp.Policy.Value, env); err != nil {
+			return false, fmt.Errorf("policy %s: %v", path, err)
+		}
+		return e.evaluateSignature(env.Rule, env.Identities, make([]bool, len(e.signers))), nil
+	case common.Policy_IMPLICIT_META:
+		imp := &common.ImplicitMetaPolicy{}
+		if err := proto.Unmarshal(cp.Policy.Value, imp); err != nil {
+			return false, fmt.Errorf("policy %s: %v", path, err)
+		}
+		subs := sortedKeys(group.Groups)
+		threshold := 1
+		switch imp.Rule {
+		case common.ImplicitMetaPolicy_ALL:
+			threshold = len(subs)
+		case common.ImplicitMetaPolicy_MAJORITY:
+			threshold = len(subs)/2 + 1
+		}
+		// fabric treats a group without sub-groups as satisfied by nobody signing
+		if len(subs) == 0 {
+			threshold = 0
+		}
+		satisfied := 0
+		for _, sub := range subs {
+			// a sub-group without the policy rejects, as in fabric
+			if _, ok := group.Groups[sub].Policies[imp.SubPolicy]; !ok {
+				continue
+			}
+			ok, err := e.evaluate(groupPath + "/" + sub + "/" + imp.SubPolicy)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				satisfied++
+			}
+		}
+		return satisfied >= threshold, nil
+	}
+	return false, fmt.Errorf("policy %s: unsupported policy type %d", path, cp.Policy.Type)
+}
+
+// evaluateSignature follows fabric's cauthdsl: an identity satisfies at most one principal.
+func (e *configPolicyEvaluator) evaluateSignature(rule *common.SignaturePolicy, principals []*mspproto.MSPPrincipal, used []bool) bool {
+	switch t := rule.GetType().(type) {
+	case *common.SignaturePolicy_SignedBy:
+		if int(t.SignedBy) >= len(principals) {
+			return false
+		}
+		for i, s := range e.signers {
+			if !used[i] && s.satisfies(principals[t.SignedBy], e.msps) {
+				used[i] = true
+				return true
+			}
+		}
+	case *common.SignaturePolicy_NOutOf_:
+		verified := 0
+		for _, r := range t.NOutOf.Rules {
+			tmp := append([]bool(nil), used...)
+			if e.evaluateSignature(r, principals, tmp) {
+				verified++
+				copy(used, tmp)
+			}
+		}
+		return verified >= int(t.NOutOf.N)
+	}
+	return false
+}
+
+// modPolicies returns the mod_policy paths a config update has to satisfy, with the elements each one
+// guards. Like fabric's configtx validator, only existing elements whose version changes are checked,
+// a new element is authorized by the version bump of its parent group.
+func modPolicies(current *common.ConfigGroup, update *common.ConfigUpdate) (map[string][]string, error) {
+	existing := make(map[string]configElement)
+	flattenConfig("/Channel", current, existing)
+	read := make(map[string]configElement)
+	if update.ReadSet != nil {
+		flattenConfig("/Channel", update.ReadSet, read)
+	}
+	write := make(map[string]configElement)
+	if update.WriteSet != nil {
+		flattenConfig("/Channel", update.WriteSet, write)
+	}
+	for key, r := range read {
+		if cur, ok := existing[key]; !ok || cur.version != r.version {
+			return nil, fmt.Errorf("%s: read set version %d is stale, the channel config changed since the update was computed", key, r.version)
+		}
+	}
+	policies := make(map[string][]string)
+	for key, w := range write {
+		if r, ok := read[key]; ok && r.version == w.version {
+			continue
+		}
+		cur, ok := existing[key]
+		if !ok {
+			continue
+		}
+		if w.version != cur.version+1 {
+			return nil, fmt.Errorf("%s: version %d does not follow the current version %d", key, w.version, cur.version)
+		}
+		if cur.modPolicy == "" {
+			return nil, fmt.Errorf("%s has no mod_policy and cannot be modified", key)
+		}
+		path := cur.modPolicy
+		if !strings.HasPrefix(path, "/") {
+			path = cur.groupPath + "/" + path
+		}
+		policies[path] = append(policies[path], key)
+	}
+	for _, keys := range policies {
+		sort.Strings(keys)
+	}
+	return policies, nil
+}
+
+// configElement is a group, value or policy of a config tree. groupPath is the group the element
+// is relative to: the group itself for groups, the containing group otherwise.
+type configElement struct {
+	groupPath string
+	version   uint64
+	modPolicy string
+}
+
+func flattenConfig(path string, group *common.ConfigGroup, m map[string]configElement) {
+	m["[Group] "+path] = configElement{groupPath: path, version: group.Version, modPolicy: group.ModPolicy}
+	for name, v := range group.Values {
+		m["[Value] "+path+"/"+name] = configElement{groupPath: path, version: v.Version, modPolicy: v.ModPolicy}
+	}
+	for name, p := range group.Policies {
+		m["[Policy] "+path+"/"+name] = configElement{groupPath: path, version: p.Version, modPolicy: p.ModPolicy}
+	}
+	for name, g := range group.Groups {
+		flattenConfig(path+"/"+name, g, m)
+	}
+}
+
+// lookupConfigPolicy returns the policy at path, e.g. /Channel/Orderer/Admins, or nil.
+func lookupConfigPolicy(root *common.ConfigGroup, path string) *common.ConfigPolicy {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return nil
+	}
+	group := lookupConfigGroup(root, path[:i])
+	if group == nil {
+		return nil
+	}
+	return group.Policies[path[i+1:]]
+}
+
+// lookupConfigGroup returns the group at path, e.g. /Channel/Application/Org1MSP, or nil.
+func lookupConfigGroup(root *common.ConfigGroup, path string) *common.ConfigGroup {
+	elems := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if elems[0] != "Channel" {
+		return nil
+	}
+	group := root
+	for _, name := range elems[1:] {
+		if group == nil {
+			return nil
+		}
+		group = group.Groups[name]
+	}
+	return group
+}
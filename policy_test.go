@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Hyperledger-TWGC/ccs-gm/sm2"
+	"github.com/Hyperledger-TWGC/ccs-gm/sm3"
+	gmx509 "github.com/Hyperledger-TWGC/ccs-gm/x509"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	mspproto "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/policydsl"
+)
+
+func testSignaturePolicy(t *testing.T, rule string) *common.ConfigPolicy {
+	env, err := policydsl.FromString(rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigPolicy{Policy: &common.Policy{Type: int32(common.Policy_SIGNATURE), Value: value}}
+}
+
+func testImplicitMetaPolicy(t *testing.T, rule common.ImplicitMetaPolicy_Rule, sub string) *common.ConfigPolicy {
+	value, err := proto.Marshal(&common.ImplicitMetaPolicy{Rule: rule, SubPolicy: sub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigPolicy{Policy: &common.Policy{Type: int32(common.Policy_IMPLICIT_META), Value: value}}
+}
+
+func testOrgGroup(t *testing.T, mspID string) *common.ConfigGroup {
+	mc, err := proto.Marshal(&mspproto.FabricMSPConfig{Name: mspID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(&mspproto.MSPConfig{Config: mc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigGroup{
+		Values:   map[string]*common.ConfigValue{mspKey: {Value: value}},
+		Policies: map[string]*common.ConfigPolicy{adminsPolicyKey: testSignaturePolicy(t, "OR('"+mspID+".member')")},
+	}
+}
+
+// testSignature returns a config signature by a new identity of the msp.
+func testSignature(t *testing.T, mspID string) *common.ConfigSignature {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "user@" + mspID},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&mspproto.SerializedIdentity{Mspid: mspID, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := proto.Marshal(&common.SignatureHeader{Creator: creator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigSignature{SignatureHeader: header}
+}
+
+func TestConfigPolicyEvaluator(t *testing.T) {
+	root := &common.ConfigGroup{
+		Groups: map[string]*common.ConfigGroup{
+			applicationGroupKey: {
+				Groups: map[string]*common.ConfigGroup{
+					"Org1": testOrgGroup(t, "Org1MSP"),
+					"Org2": testOrgGroup(t, "Org2MSP"),
+					"Org3": testOrgGroup(t, "Org3MSP"),
+				},
+				Policies: map[string]*common.ConfigPolicy{
+					"Any":      testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ANY, adminsPolicyKey),
+					"All":      testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ALL, adminsPolicyKey),
+					"Majority": testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_MAJORITY, adminsPolicyKey),
+				},
+			},
+			"Empty": {
+				Policies: map[string]*common.ConfigPolicy{
+					"Any":      testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ANY, adminsPolicyKey),
+					"All":      testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_ALL, adminsPolicyKey),
+					"Majority": testImplicitMetaPolicy(t, common.ImplicitMetaPolicy_MAJORITY, adminsPolicyKey),
+				},
+			},
+		},
+		Policies: map[string]*common.ConfigPolicy{
+			"TwoOfThree":  testSignaturePolicy(t, "OutOf(2, 'Org1MSP.member', 'Org2MSP.member', 'Org3MSP.member')"),
+			"TwoOfOrg1":   testSignaturePolicy(t, "AND('Org1MSP.member', 'Org1MSP.member')"),
+			"Org1AndOrg2": testSignaturePolicy(t, "AND('Org1MSP.member', 'Org2MSP.member')"),
+		},
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		signers []string
+		want    bool
+	}{
+		{"signature 2 of 3 by one", "/Channel/TwoOfThree", []string{"Org1MSP"}, false},
+		{"signature 2 of 3 by two", "/Channel/TwoOfThree", []string{"Org1MSP", "Org3MSP"}, true},
+		{"signature 2 of 3 by an outsider", "/Channel/TwoOfThree", []string{"Org1MSP", "Org4MSP"}, false},
+		{"signature identity counts once", "/Channel/TwoOfOrg1", []string{"Org1MSP"}, false},
+		{"signature two identities of one msp", "/Channel/TwoOfOrg1", []string{"Org1MSP", "Org1MSP"}, true},
+		{"signature and", "/Channel/Org1AndOrg2", []string{"Org2MSP", "Org1MSP"}, true},
+		{"any by nobody", "/Channel/Application/Any", nil, false},
+		{"any by one", "/Channel/Application/Any", []string{"Org2MSP"}, true},
+		{"all by two", "/Channel/Application/All", []string{"Org1MSP", "Org2MSP"}, false},
+		{"all by three", "/Channel/Application/All", []string{"Org1MSP", "Org2MSP", "Org3MSP"}, true},
+		{"majority by one", "/Channel/Application/Majority", []string{"Org1MSP"}, false},
+		{"majority by two", "/Channel/Application/Majority", []string{"Org1MSP", "Org3MSP"}, true},
+		{"empty group any", "/Channel/Empty/Any", nil, true},
+		{"empty group all", "/Channel/Empty/All", nil, true},
+		{"empty group majority", "/Channel/Empty/Majority", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sigs []*common.ConfigSignature
+			for _, mspID := range tt.signers {
+				sigs = append(sigs, testSignature(t, mspID))
+			}
+			e, err := newConfigPolicyEvaluator(root, sigs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.evaluate(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("evaluate(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigPolicyEvaluatorMissingPolicy(t *testing.T) {
+	e, err := newConfigPolicyEvaluator(&common.ConfigGroup{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.evaluate("/Channel/Admins"); err == nil {
+		t.Error("expected an error for a missing policy")
+	}
+}
+
+// testMSP is an MSP with a self-signed ECDSA root that issues signer certificates.
+type testMSP struct {
+	id   string
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestMSP(t *testing.T, id string) *testMSP {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca." + id},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testMSP{id: id, key: key, cert: cert}
+}
+
+func (m *testMSP) group(t *testing.T) *common.ConfigGroup {
+	root := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: m.cert.Raw})
+	mc, err := proto.Marshal(&mspproto.FabricMSPConfig{Name: m.id, RootCerts: [][]byte{root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := proto.Marshal(&mspproto.MSPConfig{Config: mc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigGroup{Values: map[string]*common.ConfigValue{mspKey: {Value: value}}}
+}
+
+// sign returns the signature of configUpdate by a new identity the MSP issues.
+func (m *testMSP) sign(t *testing.T, configUpdate []byte) *common.ConfigSignature {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "admin@" + m.id},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, m.cert, &key.PublicKey, m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&mspproto.SerializedIdentity{Mspid: m.id, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := proto.Marshal(&common.SignatureHeader{Creator: creator, Nonce: []byte("nonce")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(append(append([]byte{}, header...), configUpdate...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &common.ConfigSignature{SignatureHeader: header, Signature: sig}
+}
+
+func TestVerifyConfigSignature(t *testing.T) {
+	org1, other := newTestMSP(t, "Org1MSP"), newTestMSP(t, "Org1MSP")
+	root := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+		applicationGroupKey: {Groups: map[string]*common.ConfigGroup{"Org1": org1.group(t)}},
+	}}
+	update := []byte("config update")
+
+	forged := org1.sign(t, update)
+	forged.Signature = org1.sign(t, []byte("another update")).Signature
+
+	tests := []struct {
+		name    string
+		sig     *common.ConfigSignature
+		wantErr bool
+	}{
+		{"valid", org1.sign(t, update), false},
+		{"signed another update", org1.sign(t, []byte("another update")), true},
+		{"signature of another identity", forged, true},
+		{"certificate of another ca", other.sign(t, update), true},
+		{"unknown msp", newTestMSP(t, "Org2MSP").sign(t, update), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyConfigSignature(root, update, tt.sig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyConfigSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyConfigSignatureSM2(t *testing.T) {
+	caKey, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &gmx509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.org1"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              gmx509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SignatureAlgorithm:    gmx509.SM2WithSM3,
+	}
+	caDER, err := gmx509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := gmx509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := sm2.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &gmx509.Certificate{
+		SerialNumber:       big.NewInt(2),
+		Subject:            pkix.Name{CommonName: "admin@org1"},
+		NotBefore:          time.Now(),
+		NotAfter:           time.Now().Add(time.Hour),
+		SignatureAlgorithm: gmx509.SM2WithSM3,
+	}
+	der, err := gmx509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := (&testMSP{id: "Org1MSP", cert: &x509.Certificate{Raw: caDER}}).group(t)
+	root := &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{"Org1": group}}
+	creator, err := proto.Marshal(&mspproto.SerializedIdentity{Mspid: "Org1MSP", IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := proto.Marshal(&common.SignatureHeader{Creator: creator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := []byte("config update")
+	h := sm3.New()
+	h.Write(append(append([]byte{}, header...), update...))
+	signature, err := key.Sign(rand.Reader, h.Sum(nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &common.ConfigSignature{SignatureHeader: header, Signature: signature}
+	if err := verifyConfigSignature(root, update, sig); err != nil {
+		t.Errorf("verifyConfigSignature() error = %v", err)
+	}
+	if err := verifyConfigSignature(root, []byte("another update"), sig); err == nil {
+		t.Error("expected an error for a signature over another update")
+	}
+}
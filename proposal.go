@@ -0,0 +1,721 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/retry"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/resource"
+)
+
+const (
+	proposalStoreDir   = "./proposals"
+	defaultProposalTTL = 24 * time.Hour
+	// a proposal still submitting after this long was left behind by a gateway that stopped
+	proposalSubmitTimeout = 10 * time.Minute
+
+	proposalPending    = "pending"
+	proposalSubmitting = "submitting"
+	proposalSubmitted  = "submitted"
+	proposalFailed     = "failed"
+	proposalExpired    = "expired"
+	// proposalDryRun is a proposal that is neither stored nor submitted, see ?dryRun=true
+	proposalDryRun = "dryRun"
+)
+
+// configProposal is a channel config update waiting for the signatures its mod_policies require.
+// It is submitted as soon as they are all satisfied.
+type configProposal struct {
+	ID          string    `json:"id,omitempty"`
+	ChannelID   string    `json:"channelID"`
+	Description string    `json:"description,omitempty"`
+	Status      string    `json:"status"`
+	CreatedBy   string    `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	Orderer     string    `json:"orderer"`
+	// UpdateTx is the unsigned config update envelope, what configtxlator and peer channel signconfigtx work with
+	UpdateTx []byte `json:"updateTx"`
+	// Changes previews what the update does to the config it was computed from
+	Changes []configChange `json:"changes,omitempty"`
+	// ReadSet and WriteSet are only filled in on a dry run
+	ReadSet      []configSetElement  `json:"readSet,omitempty"`
+	WriteSet     []configSetElement  `json:"writeSet,omitempty"`
+	Signatures   []proposalSignature `json:"signatures"`
+	Policies     []proposalPolicy    `json:"policies,omitempty"`
+	TxID         string              `json:"txID,omitempty"`
+	SubmittingAt *time.Time          `json:"submittingAt,omitempty"`
+	SubmittedAt  *time.Time          `json:"submittedAt,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+type proposalSignature struct {
+	MSPID    string    `json:"mspID"`
+	Subject  string    `json:"subject"`
+	SignedAt time.Time `json:"signedAt"`
+	// Signature is a marshalled common.ConfigSignature
+	Signature []byte `json:"signature"`
+}
+
+// proposalPolicy is a mod_policy the update has to satisfy, with the config elements it guards.
+type proposalPolicy struct {
+	Path      string   `json:"path"`
+	Type      string   `json:"type"`
+	Rule      string   `json:"rule"`
+	Satisfied bool     `json:"satisfied"`
+	Elements  []string `json:"elements"`
+}
+
+func (p *configProposal) configSignatures() ([]*common.ConfigSignature, error) {
+	var sigs []*common.ConfigSignature
+	for _, s := range p.Signatures {
+		sig := &common.ConfigSignature{}
+		if err := proto.Unmarshal(s.Signature, sig); err != nil {
+			return nil, fmt.Errorf("invalid signature of %s: %v", s.MSPID, err)
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// addSignature adds a config signature, replacing an earlier one of the same identity.
+func (p *configProposal) addSignature(sig *common.ConfigSignature) error {
+	signer, err := configSignerOf(sig)
+	if err != nil {
+		return err
+	}
+	data, err := proto.Marshal(sig)
+	if err != nil {
+		return err
+	}
+	ps := proposalSignature{MSPID: signer.mspID, SignedAt: time.Now(), Signature: data}
+	if info, err := parseCertificateInfo(signer.cert); err == nil {
+		ps.Subject = info.Subject
+	}
+	for i, s := range p.Signatures {
+		other := &common.ConfigSignature{}
+		if proto.Unmarshal(s.Signature, other) != nil {
+			continue
+		}
+		if o, err := configSignerOf(other); err == nil && o.mspID == signer.mspID && bytes.Equal(o.cert, signer.cert) {
+			p.Signatures[i] = ps
+			return nil
+		}
+	}
+	p.Signatures = append(p.Signatures, ps)
+	return nil
+}
+
+// proposalStore keeps proposals as JSON files, one per proposal.
+type proposalStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var proposals = &proposalStore{dir: proposalStoreDir}
+
+var proposalIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func (s *proposalStore) get(id string) (*configProposal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *proposalStore) load(id string) (*configProposal, error) {
+	if !proposalIDPattern.MatchString(id) {
+		return nil, badRequest("invalid proposal id %q", id)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, id+".json"))
+	if os.IsNotExist(err) {
+		return nil, &apiError{Status: http.StatusNotFound, Message: fmt.Sprintf("proposal %s is not found", id)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := &configProposal{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid proposal %s: %v", id, err)
+	}
+	if p.Status == proposalSubmitting && (p.SubmittingAt == nil || time.Since(*p.SubmittingAt) > proposalSubmitTimeout) {
+		p.Status = proposalFailed
+		p.Error = "submission was interrupted, the update may or may not have reached the orderer"
+	}
+	if (p.Status == proposalPending || p.Status == proposalFailed) && time.Now().After(p.ExpiresAt) {
+		p.Status = proposalExpired
+	}
+	return p, nil
+}
+
+func (s *proposalStore) save(p *configProposal) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(s.dir, p.ID+".json"))
+}
+
+// update loads the proposal, applies fn and saves the result, all under the store lock.
+func (s *proposalStore) update(id string, fn func(p *configProposal) error) (*configProposal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	return p, s.save(p)
+}
+
+func newProposalID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// configUpdateTx wraps a marshalled common.ConfigUpdate in the envelope SaveChannel and the fabric
+// tools expect.
+func configUpdateTx(channelID string, configUpdate []byte) ([]byte, error) {
+	data, err := proto.Marshal(&common.ConfigUpdateEnvelope{ConfigUpdate: configUpdate})
+	if err != nil {
+		return nil, err
+	}
+	chdr, err := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG_UPDATE), ChannelId: channelID})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: chdr}, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&common.Envelope{Payload: payload})
+}
+
+// parseConfigUpdate accepts a config update envelope or a bare marshalled ConfigUpdate and returns
+// the envelope, without signatures, and the update it carries.
+func parseConfigUpdate(channelID string, data []byte) ([]byte, *common.ConfigUpdate, error) {
+	raw, err := resource.ExtractChannelConfig(data)
+	if err != nil || len(raw) == 0 {
+		raw = data
+	}
+	update := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(raw, update); err != nil || update.WriteSet == nil {
+		return nil, nil, badRequest("configUpdate is neither a config update envelope nor a ConfigUpdate")
+	}
+	if update.ChannelId != channelID {
+		return nil, nil, badRequest("config update is for channel %s, not %s", update.ChannelId, channelID)
+	}
+	tx, err := configUpdateTx(channelID, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, update, nil
+}
+
+type createProposalRequest struct {
+	identityRequest
+	ChannelID   string `json:"channelID"`
+	Description string `json:"description,omitempty"`
+	// ConfigUpdate is a config update envelope (.tx) or a marshalled ConfigUpdate, or give ConfigUpdateArtifact
+	ConfigUpdate         []byte `json:"configUpdate,omitempty"`
+	ConfigUpdateArtifact string `json:"configUpdateArtifact,omitempty"`
+	TTL                  string `json:"ttl,omitempty"`
+	// SkipSign leaves the proposal without the signature of the request identity
+	SkipSign bool   `json:"skipSign,omitempty"`
+	Orderer  string `json:"orderer,omitempty"`
+
+	ttl    time.Duration
+	dryRun bool
+}
+
+func (r *createProposalRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if (len(r.ConfigUpdate) == 0) == (r.ConfigUpdateArtifact == "") {
+		return fmt.Errorf("one of configUpdate and configUpdateArtifact is required")
+	}
+	ttl, err := parseProposalTTL(r.TTL)
+	if err != nil {
+		return err
+	}
+	r.ttl = ttl
+	if r.Orderer == "" {
+		r.Orderer = ordererEndpoint
+	}
+	return nil
+}
+
+func parseProposalTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultProposalTTL, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+	return d, nil
+}
+
+type signProposalRequest struct {
+	identityRequest
+	ID string `json:"id"`
+	// Signature is a marshalled ConfigSignature made elsewhere, e.g. with CreateConfigSignatureFromReader,
+	// SignedTx the update envelope as peer channel signconfigtx leaves it. Without either the request
+	// identity signs.
+	Signature []byte `json:"signature,omitempty"`
+	SignedTx  []byte `json:"signedTx,omitempty"`
+}
+
+func (r *signProposalRequest) validate() error {
+	r.setDefaults()
+	if r.ID == "" {
+		return fmt.Errorf("id is required")
+	}
+	if len(r.Signature) > 0 && len(r.SignedTx) > 0 {
+		return fmt.Errorf("signature and signedTx are mutually exclusive")
+	}
+	return nil
+}
+
+type signConfigUpdateRequest struct {
+	identityRequest
+	ChannelID    string `json:"channelID"`
+	ConfigUpdate []byte `json:"configUpdate"`
+}
+
+func (r *signConfigUpdateRequest) validate() error {
+	r.setDefaults()
+	if r.ChannelID == "" {
+		return fmt.Errorf("channelID is required")
+	}
+	if len(r.ConfigUpdate) == 0 {
+		return fmt.Errorf("configUpdate is required")
+	}
+	return nil
+}
+
+func createProposal(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := isDryRun(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	req := createProposalRequest{dryRun: dryRun}
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	p, err := doCreateProposal(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+}
+
+func doCreateProposal(profile sdkProfile, req *createProposalRequest) (p *configProposal, err error) {
+	data := req.ConfigUpdate
+	if req.ConfigUpdateArtifact != "" {
+		if data, err = artifacts.get(req.ConfigUpdateArtifact); err != nil {
+			return nil, err
+		}
+	}
+	tx, _, err := parseConfigUpdate(req.ChannelID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	return newConfigProposal(sdk, req.identityRequest, req.ChannelID, req.Description, nil, tx, req.ttl, req.Orderer, !req.SkipSign, req.dryRun)
+}
+
+// newConfigProposal stores a proposal for the config update envelope, signed by the identity unless
+// sign is false, and submits it right away if that signature is all its mod_policies need. current is
+// the config the update was computed from, if known. With dryRun the proposal is only previewed.
+func newConfigProposal(sdk *pooledSDK, identity identityRequest, channelID, description string, current *common.Config, tx []byte, ttl time.Duration, orderer string, sign, dryRun bool) (*configProposal, error) {
+	if dryRun {
+		if current == nil {
+			_, config, err := queryChannelConfig(sdk, identity, channelID, orderer)
+			if err != nil {
+				return nil, err
+			}
+			current = config
+		}
+		var signers []identityRequest
+		if sign {
+			signers = append(signers, identity)
+		}
+		p, _, err := dryRunConfigUpdate(sdk, identity, signers, channelID, orderer, current, tx)
+		if err != nil {
+			return nil, err
+		}
+		p.Description, p.ExpiresAt = description, p.CreatedAt.Add(ttl)
+		return p, nil
+	}
+
+	now := time.Now()
+	p := &configProposal{
+		ChannelID:   channelID,
+		Description: description,
+		Status:      proposalPending,
+		CreatedBy:   identity.User + "@" + identity.Org,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+		Orderer:     orderer,
+		UpdateTx:    tx,
+		Signatures:  []proposalSignature{},
+	}
+	if sign {
+		sig, err := signConfigUpdate(sdk, identity, tx)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.addSignature(sig); err != nil {
+			return nil, err
+		}
+	}
+	if current != nil {
+		_, update, err := parseConfigUpdate(channelID, tx)
+		if err != nil {
+			return nil, err
+		}
+		p.Changes = configDiff(current, mergeConfigUpdate(current, update))
+	}
+
+	id, err := newProposalID()
+	if err != nil {
+		return nil, err
+	}
+	p.ID = id
+	proposals.mu.Lock()
+	err = proposals.save(p)
+	proposals.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("error saving proposal: %v", err)
+	}
+	log.Printf("created config update proposal %s for channel %s\n", p.ID, channelID)
+	return submitIfReady(sdk, identity, p.ID)
+}
+
+func signConfigUpdate(sdk *pooledSDK, identity identityRequest, tx []byte) (*common.ConfigSignature, error) {
+	resMgmtClient, err := sdk.resmgmtClient(identity.Org, identity.User)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := sdk.signingIdentity(identity.Org, identity.User)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := resMgmtClient.CreateConfigSignatureFromReader(signer, bytes.NewReader(tx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign config update: %v", err)
+	}
+	return sig, nil
+}
+
+func getProposal(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, &apiError{Status: http.StatusMethodNotAllowed, Message: fmt.Sprintf("method %s not allowed", r.Method)})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, badRequest("invalid request: id is required"))
+		return
+	}
+	p, err := proposals.get(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// the bare envelope, for peer channel signconfigtx and other offline tools
+	if r.URL.Query().Get("format") == "tx" {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(p.UpdateTx)))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.tx", p.ChannelID, p.ID))
+		if _, err := w.Write(p.UpdateTx); err != nil {
+			log.Println(err.Error())
+		}
+		return
+	}
+	writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+}
+
+func signProposal(w http.ResponseWriter, r *http.Request) {
+	var req signProposalRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	p, err := doSignProposal(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{TxID: p.TxID, Result: p})
+}
+
+func doSignProposal(profile sdkProfile, req *signProposalRequest) (p *configProposal, err error) {
+	p, err = proposals.get(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != proposalPending && p.Status != proposalFailed {
+		return nil, &apiError{Status: http.StatusConflict, Message: fmt.Sprintf("proposal %s is %s", p.ID, p.Status)}
+	}
+
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	var sigs []*common.ConfigSignature
+	switch {
+	case len(req.Signature) > 0:
+		sig := &common.ConfigSignature{}
+		if err := proto.Unmarshal(req.Signature, sig); err != nil {
+			return nil, badRequest("invalid signature: %v", err)
+		}
+		sigs = append(sigs, sig)
+	case len(req.SignedTx) > 0:
+		if sigs, err = signedTxSignatures(p, req.SignedTx); err != nil {
+			return nil, err
+		}
+	default:
+		sig, err := signConfigUpdate(sdk, req.identityRequest, p.UpdateTx)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	// the signatures decide whether the update is submitted, only accept ones that are genuine
+	_, config, err := queryChannelConfig(sdk, req.identityRequest, p.ChannelID, p.Orderer)
+	if err != nil {
+		return nil, err
+	}
+	configUpdate, err := resource.ExtractChannelConfig(p.UpdateTx)
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range sigs {
+		if err := verifyConfigSignature(config.ChannelGroup, configUpdate, sig); err != nil {
+			return nil, badRequest("invalid signature: %v", err)
+		}
+	}
+
+	_, err = proposals.update(p.ID, func(p *configProposal) error {
+		if p.Status != proposalPending && p.Status != proposalFailed {
+			return &apiError{Status: http.StatusConflict, Message: fmt.Sprintf("proposal %s is %s", p.ID, p.Status)}
+		}
+		for _, sig := range sigs {
+			if err := p.addSignature(sig); err != nil {
+				return badRequest("%v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return submitIfReady(sdk, req.identityRequest, p.ID)
+}
+
+// signedTxSignatures returns the signatures of a signed copy of the proposal's update envelope.
+func signedTxSignatures(p *configProposal, signedTx []byte) ([]*common.ConfigSignature, error) {
+	signed, err := resource.CreateConfigUpdateEnvelope(signedTx)
+	if err != nil {
+		return nil, badRequest("invalid signedTx: %v", err)
+	}
+	own, err := resource.ExtractChannelConfig(p.UpdateTx)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(signed.ConfigUpdate, own) {
+		return nil, badRequest("signedTx carries a different config update than proposal %s", p.ID)
+	}
+	if len(signed.Signatures) == 0 {
+		return nil, badRequest("signedTx has no signatures")
+	}
+	return signed.Signatures, nil
+}
+
+// submitIfReady checks the mod_policies of the proposal against the current channel config and, if
+// the signatures satisfy them all, submits the update to the orderer.
+func submitIfReady(sdk *pooledSDK, identity identityRequest, id string) (*configProposal, error) {
+	p, err := proposals.get(id)
+	if err != nil {
+		return nil, err
+	}
+	_, config, err := queryChannelConfig(sdk, identity, p.ChannelID, p.Orderer)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := resource.ExtractChannelConfig(p.UpdateTx)
+	if err != nil {
+		return nil, err
+	}
+	update := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(raw, update); err != nil {
+		return nil, err
+	}
+	sigs, err := p.configSignatures()
+	if err != nil {
+		return nil, err
+	}
+	policies, err := checkModPolicies(config.ChannelGroup, update, sigs)
+	if err != nil {
+		return nil, badRequest("proposal %s: %v", p.ID, err)
+	}
+
+	ready := true
+	for _, pp := range policies {
+		ready = ready && pp.Satisfied
+	}
+	p, err = proposals.update(id, func(p *configProposal) error {
+		p.Policies = policies
+		if ready && (p.Status == proposalPending || p.Status == proposalFailed) {
+			now := time.Now()
+			p.Status = proposalSubmitting
+			p.SubmittingAt = &now
+		} else {
+			ready = false
+		}
+		return nil
+	})
+	if err != nil || !ready {
+		return p, err
+	}
+
+	resMgmtClient, err := sdk.resmgmtClient(identity.Org, identity.User)
+	if err != nil {
+		return nil, err
+	}
+	resp, submitErr := resMgmtClient.SaveChannel(resmgmt.SaveChannelRequest{
+		ChannelID:     p.ChannelID,
+		ChannelConfig: bytes.NewReader(p.UpdateTx),
+	}, resmgmt.WithConfigSignatures(sigs...), resmgmt.WithRetry(retry.DefaultResMgmtOpts), resmgmt.WithOrdererEndpoint(p.Orderer))
+	p, err = proposals.update(id, func(p *configProposal) error {
+		if submitErr != nil {
+			p.Status = proposalFailed
+			p.Error = submitErr.Error()
+			return nil
+		}
+		now := time.Now()
+		p.Status = proposalSubmitted
+		p.TxID = string(resp.TransactionID)
+		p.SubmittedAt = &now
+		p.Error = ""
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if submitErr != nil {
+		return nil, fmt.Errorf("failed to submit proposal %s: %v", id, submitErr)
+	}
+	log.Printf("submitted config update proposal %s for channel %s, tx %s\n", id, p.ChannelID, p.TxID)
+	return p, nil
+}
+
+// checkModPolicies evaluates every mod_policy the update touches against the signatures.
+func checkModPolicies(current *common.ConfigGroup, update *common.ConfigUpdate, sigs []*common.ConfigSignature) ([]proposalPolicy, error) {
+	paths, err := modPolicies(current, update)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newConfigPolicyEvaluator(current, sigs)
+	if err != nil {
+		return nil, err
+	}
+	var policies []proposalPolicy
+	for path, elems := range paths {
+		ok, err := e.evaluate(path)
+		if err != nil {
+			return nil, err
+		}
+		pp := proposalPolicy{Path: path, Satisfied: ok, Elements: elems}
+		if cp := lookupConfigPolicy(current, path); cp != nil {
+			pp.Type, pp.Rule = policyRule(cp.Policy)
+		}
+		policies = append(policies, pp)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Path < policies[j].Path })
+	return policies, nil
+}
+
+func signConfigUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	var req signConfigUpdateRequest
+	if err := decodeRequest(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	sig, err := doSignConfigUpdate(sdkProfileOf(r), &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeResponse(w, apiResponse{Result: map[string][]byte{"signature": sig}})
+}
+
+// doSignConfigUpdate signs an update proposed on another gateway, the signature is then handed to
+// that gateway's /channel/proposal/sign.
+func doSignConfigUpdate(profile sdkProfile, req *signConfigUpdateRequest) (data []byte, err error) {
+	tx, _, err := parseConfigUpdate(req.ChannelID, req.ConfigUpdate)
+	if err != nil {
+		return nil, err
+	}
+	sdk, err := sdks.acquire(profile)
+	if err != nil {
+		return nil, err
+	}
+	defer sdk.release(&err)
+
+	sig, err := signConfigUpdate(sdk, req.identityRequest, tx)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(sig)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProposalStoreLoadStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proposals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := &proposalStore{dir: dir}
+
+	now := time.Now()
+	recent, stale := now.Add(-time.Minute), now.Add(-proposalSubmitTimeout-time.Minute)
+	tests := []struct {
+		name         string
+		status       string
+		expiresAt    time.Time
+		submittingAt *time.Time
+		want         string
+	}{
+		{"pending", proposalPending, now.Add(time.Hour), nil, proposalPending},
+		{"pending expired", proposalPending, now.Add(-time.Hour), nil, proposalExpired},
+		{"failed", proposalFailed, now.Add(time.Hour), nil, proposalFailed},
+		{"failed expired", proposalFailed, now.Add(-time.Hour), nil, proposalExpired},
+		{"submitting", proposalSubmitting, now.Add(-time.Hour), &recent, proposalSubmitting},
+		{"submitting stale", proposalSubmitting, now.Add(time.Hour), &stale, proposalFailed},
+		{"submitting stale and expired", proposalSubmitting, now.Add(-time.Hour), &stale, proposalExpired},
+		{"submitted expired", proposalSubmitted, now.Add(-time.Hour), &stale, proposalSubmitted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := newProposalID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := &configProposal{ID: id, Status: tt.status, ExpiresAt: tt.expiresAt, SubmittingAt: tt.submittingAt}
+			if err := s.save(p); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("status = %s, want %s", got.Status, tt.want)
+			}
+		})
+	}
+}
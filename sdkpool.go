@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	mspclient "github.com/hyperledger/fabric-sdk-go/pkg/client/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	pmsp "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+const (
+	cryptoSW = "SW"
+	cryptoGM = "GM"
+)
+
+// sdkProfile identifies a connection profile together with the crypto profile it is configured for.
+type sdkProfile struct {
+	ConfigPath string
+	Crypto     string
+}
+
+var (
+	swProfile = sdkProfile{ConfigPath: configFilePath, Crypto: cryptoSW}
+	gmProfile = sdkProfile{ConfigPath: gmConfigFilePath, Crypto: cryptoGM}
+)
+
+// sdkProfileOf picks the SDK profile by URL prefix: /gm/... uses the GM crypto profile.
+func sdkProfileOf(r *http.Request) sdkProfile {
+	if strings.HasPrefix(r.URL.Path, "/gm") {
+		return gmProfile
+	}
+	return swProfile
+}
+
+type identityKey struct {
+	org  string
+	user string
+}
+
+type channelKey struct {
+	channelID string
+	identityKey
+}
+
+// pooledSDK is a long-lived fabsdk instance shared by all requests against one profile,
+// together with the clients created from it.
+type pooledSDK struct {
+	*fabsdk.FabricSDK
+	profile sdkProfile
+
+	mu             sync.Mutex
+	refs           int
+	evicted        bool
+	resmgmtClients map[identityKey]*resmgmt.Client
+	channelClients map[channelKey]*channel.Client
+	mspClients     map[string]*mspclient.Client
+}
+
+// sdkRegistry lazily creates one pooledSDK per profile and evicts it when it turns unhealthy.
+type sdkRegistry struct {
+	mu     sync.Mutex
+	sdks   map[sdkProfile]*pooledSDK
+	closed bool
+}
+
+var sdks = &sdkRegistry{sdks: make(map[sdkProfile]*pooledSDK)}
+
+// acquire returns the SDK for the profile, creating it on first use.
+// Every successful acquire must be paired with a release.
+func (r *sdkRegistry) acquire(profile sdkProfile) (*pooledSDK, error) {
+	r.mu.Lock()
+	p, err := r.pooled(profile)
+	r.mu.Unlock()
+	if p != nil || err != nil {
+		return p, err
+	}
+
+	// creating an SDK loads the config and crypto material, keep other profiles going meanwhile
+	sdk, err := fabsdk.New(config.FromFile(profile.ConfigPath))
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, err = r.pooled(profile); p != nil || err != nil {
+		// shutting down, or another request created the SDK first
+		sdk.Close()
+		return p, err
+	}
+	p = &pooledSDK{
+		FabricSDK:      sdk,
+		profile:        profile,
+		refs:           1,
+		resmgmtClients: make(map[identityKey]*resmgmt.Client),
+		channelClients: make(map[channelKey]*channel.Client),
+		mspClients:     make(map[string]*mspclient.Client),
+	}
+	r.sdks[profile] = p
+	log.Printf("sdk created for %s (%s)\n", profile.ConfigPath, profile.Crypto)
+	return p, nil
+}
+
+// pooled takes a reference on the SDK of the profile if there is one. r.mu must be held.
+func (r *sdkRegistry) pooled(profile sdkProfile) (*pooledSDK, error) {
+	if r.closed {
+		return nil, fmt.Errorf("gateway is shutting down")
+	}
+	p, ok := r.sdks[profile]
+	if !ok {
+		return nil, nil
+	}
+	p.mu.Lock()
+	p.refs++
+	p.mu.Unlock()
+	return p, nil
+}
+
+// evict removes p from the registry. It is closed once the last request using it releases it.
+func (r *sdkRegistry) evict(p *pooledSDK, reason error) {
+	r.mu.Lock()
+	if r.sdks[p.profile] == p {
+		delete(r.sdks, p.profile)
+	}
+	r.mu.Unlock()
+
+	p.mu.Lock()
+	p.evicted = true
+	p.mu.Unlock()
+	log.Printf("sdk for %s (%s) evicted: %v\n", p.profile.ConfigPath, p.profile.Crypto, reason)
+}
+
+// close evicts every SDK and rejects further acquires. Called on gateway shutdown.
+func (r *sdkRegistry) close() {
+	r.mu.Lock()
+	r.closed = true
+	pooled := r.sdks
+	r.sdks = make(map[sdkProfile]*pooledSDK)
+	r.mu.Unlock()
+
+	for _, p := range pooled {
+		p.mu.Lock()
+		p.evicted = true
+		idle := p.refs == 0
+		p.mu.Unlock()
+		if idle {
+			p.Close()
+		}
+	}
+}
+
+// release returns p to the registry. If *errp reports a broken connection the SDK is evicted,
+// so that the next request rebuilds connections and discovery from scratch.
+func (p *pooledSDK) release(errp *error) {
+	if errp != nil && isUnhealthy(*errp) {
+		sdks.evict(p, *errp)
+	}
+	p.mu.Lock()
+	p.refs--
+	closeNow := p.evicted && p.refs == 0
+	p.mu.Unlock()
+	if closeNow {
+		p.Close()
+	}
+}
+
+func (p *pooledSDK) resmgmtClient(org, user string) (*resmgmt.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := identityKey{org: org, user: user}
+	if c, ok := p.resmgmtClients[key]; ok {
+		return c, nil
+	}
+	c, err := resmgmt.New(p.Context(fabsdk.WithUser(user), fabsdk.WithOrg(org)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource management client by client context: %v", err)
+	}
+	p.resmgmtClients[key] = c
+	return c, nil
+}
+
+func (p *pooledSDK) channelClient(channelID, org, user string) (*channel.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := channelKey{channelID: channelID, identityKey: identityKey{org: org, user: user}}
+	if c, ok := p.channelClients[key]; ok {
+		return c, nil
+	}
+	c, err := channel.New(p.ChannelContext(channelID, fabsdk.WithUser(user), fabsdk.WithOrg(org)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create channel client for %s: %v", channelID, err)
+	}
+	p.channelClients[key] = c
+	return c, nil
+}
+
+func (p *pooledSDK) signingIdentity(org, user string) (pmsp.SigningIdentity, error) {
+	p.mu.Lock()
+	c, ok := p.mspClients[org]
+	if !ok {
+		var err error
+		c, err = mspclient.New(p.Context(), mspclient.WithOrg(org))
+		if err != nil {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("failed to create Org MSP client by specified OrgName: %v", err)
+		}
+		p.mspClients[org] = c
+	}
+	p.mu.Unlock()
+
+	id, err := c.GetSigningIdentity(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the signature of the specified ID: %v", err)
+	}
+	return id, nil
+}
+
+// isUnhealthy reports whether err was caused by a broken connection rather than by the request itself.
+func isUnhealthy(err error) bool {
+	if err == nil {
+		return false
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Group {
+		case status.GRPCTransportStatus:
+			return true
+		case status.ClientStatus, status.EndorserClientStatus, status.OrdererClientStatus:
+			if s.Code == status.ConnectionFailed.ToInt32() {
+				return true
+			}
+		}
+	}
+	// most errors are wrapped with fmt.Errorf and lose their status, so fall back to the message
+	msg := err.Error()
+	return strings.Contains(msg, status.CodeName[status.ConnectionFailed.ToInt32()]) ||
+		strings.Contains(msg, "code = Unavailable")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/events/deliverclient"
+)
+
+const (
+	commitWaitOne  = "one"
+	commitWaitAll  = "all"
+	commitWaitNone = "none"
+)
+
+// commitStatus is the outcome of a transaction as reported by the deliver service of one peer.
+type commitStatus struct {
+	Peer           string `json:"peer"`
+	ValidationCode string `json:"validationCode"`
+	BlockNumber    uint64 `json:"blockNumber"`
+}
+
+// staticDiscovery hands a fixed set of peers to a deliver client, so that it connects to exactly those.
+type staticDiscovery []fab.Peer
+
+func (d staticDiscovery) GetPeers() ([]fab.Peer, error) {
+	return d, nil
+}
+
+// commitHandler takes the place of invoke.CommitTxHandler: it sends the endorsed transaction to the
+// orderer and then waits for the commit event on one peer, on every endorsing peer, or not at all.
+type commitHandler struct {
+	chCtx   context.Channel
+	waitFor string
+	timeout time.Duration
+
+	commits []commitStatus
+}
+
+func newCommitHandler(chCtx context.Channel, waitFor string, timeout time.Duration) *commitHandler {
+	return &commitHandler{chCtx: chCtx, waitFor: waitFor, timeout: timeout}
+}
+
+func (h *commitHandler) Handle(requestContext *invoke.RequestContext, clientContext *invoke.ClientContext) {
+	// the channel client may retry the whole chain, start over every time
+	h.commits = nil
+	txnID := string(requestContext.Response.TransactionID)
+
+	var services []fab.EventService
+	switch h.waitFor {
+	case commitWaitOne:
+		services = append(services, clientContext.EventService)
+	case commitWaitAll:
+		clients, err := h.deliverClients(requestContext.Response.Responses, clientContext.Discovery)
+		if err != nil {
+			requestContext.Error = err
+			return
+		}
+		defer func() {
+			for _, c := range clients {
+				c.Close()
+			}
+		}()
+		for _, c := range clients {
+			services = append(services, c)
+		}
+	}
+
+	// register before sending, otherwise the event may be missed
+	notifiers := make([]<-chan *fab.TxStatusEvent, 0, len(services))
+	for _, es := range services {
+		reg, notifier, err := es.RegisterTxStatusEvent(txnID)
+		if err != nil {
+			requestContext.Error = fmt.Errorf("error registering for TxStatus event: %v", err)
+			return
+		}
+		defer es.Unregister(reg)
+		notifiers = append(notifiers, notifier)
+	}
+
+	tx, err := clientContext.Transactor.CreateTransaction(fab.TransactionRequest{
+		Proposal:          requestContext.Response.Proposal,
+		ProposalResponses: requestContext.Response.Responses,
+	})
+	if err != nil {
+		requestContext.Error = fmt.Errorf("CreateTransaction failed: %v", err)
+		return
+	}
+	if _, err := clientContext.Transactor.SendTransaction(tx); err != nil {
+		requestContext.Error = fmt.Errorf("SendTransaction failed: %v", err)
+		return
+	}
+
+	var timeout <-chan time.Time
+	if h.timeout > 0 {
+		timer := time.NewTimer(h.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for _, notifier := range notifiers {
+		select {
+		case txStatus := <-notifier:
+			h.commits = append(h.commits, commitStatus{
+				Peer:           txStatus.SourceURL,
+				ValidationCode: txStatus.TxValidationCode.String(),
+				BlockNumber:    txStatus.BlockNumber,
+			})
+			requestContext.Response.TxValidationCode = txStatus.TxValidationCode
+			if txStatus.TxValidationCode != pb.TxValidationCode_VALID {
+				requestContext.Error = status.New(status.EventServerStatus, int32(txStatus.TxValidationCode),
+					fmt.Sprintf("transaction %s is invalid on %s: %s", txnID, txStatus.SourceURL, txStatus.TxValidationCode), nil)
+				return
+			}
+		case <-timeout:
+			requestContext.Error = status.New(status.ClientStatus, status.Timeout.ToInt32(),
+				fmt.Sprintf("transaction %s was not committed within %s", txnID, h.timeout), nil)
+			return
+		case <-requestContext.Ctx.Done():
+			requestContext.Error = status.New(status.ClientStatus, status.Timeout.ToInt32(),
+				"Execute didn't receive block event", nil)
+			return
+		}
+	}
+}
+
+// deliverClients connects a deliver client to each endorsing peer.
+func (h *commitHandler) deliverClients(responses []*fab.TransactionProposalResponse, discovery fab.DiscoveryService) (clients []*deliverclient.Client, err error) {
+	defer func() {
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+		}
+	}()
+	peers, err := discovery.GetPeers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel peers: %v", err)
+	}
+	byURL := make(map[string]fab.Peer, len(peers))
+	for _, p := range peers {
+		byURL[p.URL()] = p
+	}
+	chConfig, err := h.chCtx.ChannelService().ChannelConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel config: %v", err)
+	}
+	for _, r := range responses {
+		p, ok := byURL[r.Endorser]
+		if !ok {
+			return clients, fmt.Errorf("endorser %s is not a known channel peer", r.Endorser)
+		}
+		c, err := deliverclient.New(h.chCtx, chConfig, staticDiscovery{p})
+		if err != nil {
+			return clients, fmt.Errorf("failed to connect to deliver service of %s: %v", r.Endorser, err)
+		}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}